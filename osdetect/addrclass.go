@@ -0,0 +1,141 @@
+package osdetect
+
+import "net/netip"
+
+// AddrClass classifies an IP address by where it is reachable from.
+type AddrClass string
+
+const (
+	AddrLoopback      AddrClass = "loopback"      // 127.0.0.0/8, ::1
+	AddrLinkLocal     AddrClass = "link-local"    // 169.254.0.0/16, fe80::/10
+	AddrPrivate       AddrClass = "private"       // RFC 1918: 10/8, 172.16/12, 192.168/16
+	AddrCGNAT         AddrClass = "cgnat"         // RFC 6598 shared address space, 100.64.0.0/10
+	AddrULA           AddrClass = "ula"           // IPv6 unique local, fc00::/7
+	AddrDocumentation AddrClass = "documentation" // e.g., 192.0.2.0/24, 2001:db8::/32
+	AddrReserved      AddrClass = "reserved"      // Unspecified, multicast and other special-purpose ranges
+	AddrPublic        AddrClass = "public"
+)
+
+var (
+	cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+	documentationPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+		netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+		netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("3fff::/20"),
+	}
+
+	// IANA special-purpose ranges not covered by the classes above
+	reservedPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+		netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+		netip.MustParsePrefix("240.0.0.0/4"),   // Includes 255.255.255.255
+		netip.MustParsePrefix("100::/64"),      // Discard-only
+	}
+)
+
+// ClassifyAddr classifies ip without any network access.
+func ClassifyAddr(ip netip.Addr) AddrClass {
+	ip = ip.Unmap()
+	switch {
+	case !ip.IsValid(), ip.IsUnspecified(), ip.IsMulticast():
+		return AddrReserved
+	case ip.IsLoopback():
+		return AddrLoopback
+	case ip.IsLinkLocalUnicast():
+		return AddrLinkLocal
+	case ip.Is4() && ip.IsPrivate():
+		return AddrPrivate
+	case ip.Is6() && ip.IsPrivate():
+		return AddrULA
+	case cgnatPrefix.Contains(ip):
+		return AddrCGNAT
+	}
+	for _, p := range documentationPrefixes {
+		if p.Contains(ip) {
+			return AddrDocumentation
+		}
+	}
+	for _, p := range reservedPrefixes {
+		if p.Contains(ip) {
+			return AddrReserved
+		}
+	}
+	return AddrPublic
+}
+
+// AddressSummary groups the host's non-loopback addresses by class.
+type AddressSummary struct {
+	IPv4 map[AddrClass][]netip.Addr
+	IPv6 map[AddrClass][]netip.Addr
+}
+
+// HasPublicIPv4 reports whether any interface has a public IPv4 address.
+func (s *AddressSummary) HasPublicIPv4() bool {
+	return len(s.IPv4[AddrPublic]) > 0
+}
+
+// HasPublicIPv6 reports whether any interface has a public IPv6 address.
+func (s *AddressSummary) HasPublicIPv6() bool {
+	return len(s.IPv6[AddrPublic]) > 0
+}
+
+// BehindNAT reports whether the host has IPv4 connectivity only through
+// private or CGNAT addresses, so inbound IPv4 needs port forwarding.
+func (s *AddressSummary) BehindNAT() bool {
+	return !s.HasPublicIPv4() && (len(s.IPv4[AddrPrivate]) > 0 || len(s.IPv4[AddrCGNAT]) > 0)
+}
+
+// Warnings describes address problems a setup wizard should show, e.g.,
+// "host has no public IPv4 address". It returns nil if there are none.
+func (s *AddressSummary) Warnings() []string {
+	var warnings []string
+	if !s.HasPublicIPv4() {
+		warnings = append(warnings, "host has no public IPv4 address")
+	}
+	if len(s.IPv4[AddrCGNAT]) > 0 && !s.HasPublicIPv4() {
+		warnings = append(warnings, "host is behind carrier-grade NAT (100.64.0.0/10); inbound IPv4 connections are not possible")
+	} else if s.BehindNAT() {
+		warnings = append(warnings, "host is behind NAT; inbound IPv4 connections need port forwarding")
+	}
+	if !s.HasPublicIPv6() {
+		warnings = append(warnings, "host has no public IPv6 address")
+	}
+	return warnings
+}
+
+// SummarizeAddresses classifies the addresses of the host's interfaces.
+func SummarizeAddresses() (*AddressSummary, error) {
+	return defaultDetector.SummarizeAddresses()
+}
+
+// SummarizeAddresses classifies the addresses of the interfaces returned by
+// Interfaces. Addresses are only read locally, so a host behind a 1:1 NAT,
+// such as a cloud instance with an elastic IP, reports no public IPv4.
+func (d *Detector) SummarizeAddresses() (*AddressSummary, error) {
+	ifaces, err := d.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &AddressSummary{
+		IPv4: make(map[AddrClass][]netip.Addr),
+		IPv6: make(map[AddrClass][]netip.Addr),
+	}
+	for _, iface := range ifaces {
+		if iface.IsLoopback() {
+			continue
+		}
+		for _, a := range iface.Addrs {
+			if a.Is6() {
+				summary.IPv6[a.Class] = append(summary.IPv6[a.Class], a.Addr())
+			} else {
+				summary.IPv4[a.Class] = append(summary.IPv4[a.Class], a.Addr())
+			}
+		}
+	}
+	return summary, nil
+}
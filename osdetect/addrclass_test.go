@@ -0,0 +1,56 @@
+package osdetect
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestClassifyAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want AddrClass
+	}{
+		{"127.0.0.1", AddrLoopback},
+		{"127.255.255.254", AddrLoopback},
+		{"::1", AddrLoopback},
+		{"::ffff:127.0.0.1", AddrLoopback},
+		{"169.254.169.254", AddrLinkLocal},
+		{"fe80::1", AddrLinkLocal},
+		{"febf::1", AddrLinkLocal},
+		{"fc00::1", AddrULA},
+		{"fd12:3456:789a::1", AddrULA},
+		{"10.0.0.1", AddrPrivate},
+		{"172.16.0.1", AddrPrivate},
+		{"172.31.255.255", AddrPrivate},
+		{"172.32.0.1", AddrPublic},
+		{"192.168.1.10", AddrPrivate},
+		{"::ffff:192.168.1.10", AddrPrivate},
+		{"100.64.0.1", AddrCGNAT},
+		{"100.127.255.255", AddrCGNAT},
+		{"100.128.0.1", AddrPublic},
+		{"100.63.255.255", AddrPublic},
+		{"192.0.2.1", AddrDocumentation},
+		{"198.51.100.7", AddrDocumentation},
+		{"203.0.113.7", AddrDocumentation},
+		{"2001:db8::1", AddrDocumentation},
+		{"3fff::1", AddrDocumentation},
+		{"0.0.0.0", AddrReserved},
+		{"::", AddrReserved},
+		{"224.0.0.251", AddrReserved},
+		{"ff02::1", AddrReserved},
+		{"198.18.0.1", AddrReserved},
+		{"255.255.255.255", AddrReserved},
+		{"8.8.8.8", AddrPublic},
+		{"1.1.1.1", AddrPublic},
+		{"2606:4700:4700::1111", AddrPublic},
+		{"2a01:4f8::1", AddrPublic},
+	}
+	for _, tt := range tests {
+		if got := ClassifyAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("ClassifyAddr(%s) = %s, want %s", tt.addr, got, tt.want)
+		}
+	}
+	if got := ClassifyAddr(netip.Addr{}); got != AddrReserved {
+		t.Errorf("ClassifyAddr(invalid) = %s, want %s", got, AddrReserved)
+	}
+}
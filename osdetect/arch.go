@@ -0,0 +1,247 @@
+package osdetect
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Arch is a CPU architecture in kernel naming, as printed by `uname -m`.
+type Arch string
+
+const (
+	ArchX86_64      Arch = "x86_64"
+	ArchI686        Arch = "i686"
+	ArchAarch64     Arch = "aarch64"
+	ArchArmv7l      Arch = "armv7l"
+	ArchArmv6l      Arch = "armv6l"
+	ArchRiscv64     Arch = "riscv64"
+	ArchPpc64le     Arch = "ppc64le"
+	ArchS390x       Arch = "s390x"
+	ArchLoongarch64 Arch = "loongarch64"
+)
+
+// archNames maps an architecture to its names in other ecosystems.
+var archNames = map[Arch]struct {
+	goarch, goarm, debian, rpm, asset string
+}{
+	ArchX86_64:      {"amd64", "", "amd64", "x86_64", "amd64"},
+	ArchI686:        {"386", "", "i386", "i686", "386"},
+	ArchAarch64:     {"arm64", "", "arm64", "aarch64", "arm64"},
+	ArchArmv7l:      {"arm", "7", "armhf", "armv7hl", "armv7"},
+	ArchArmv6l:      {"arm", "6", "armel", "armv6hl", "armv6"}, // Debian armhf needs armv7; Raspbian's armv6 armhf is the exception
+	ArchRiscv64:     {"riscv64", "", "riscv64", "riscv64", "riscv64"},
+	ArchPpc64le:     {"ppc64le", "", "ppc64el", "ppc64le", "ppc64le"},
+	ArchS390x:       {"s390x", "", "s390x", "s390x", "s390x"},
+	ArchLoongarch64: {"loong64", "", "loong64", "loongarch64", "loong64"},
+}
+
+// ParseArch normalizes an architecture name from uname, Go, Debian, RPM or
+// systemd's os-release ARCHITECTURE, e.g., "amd64", "x86-64" and "x86_64"
+// all become ArchX86_64. Unknown names are returned trimmed and lowercased.
+func ParseArch(name string) Arch {
+	switch name = strings.ToLower(strings.TrimSpace(name)); name {
+	case "amd64", "x64", "x86-64":
+		return ArchX86_64
+	case "386", "i386", "i486", "i586", "x86":
+		return ArchI686
+	case "arm64", "armv8", "armv8-a":
+		return ArchAarch64
+	case "armv8l", "armv7", "armv7hl", "armhf", "arm":
+		// armv8l is a 64-bit CPU running 32-bit code, which uses armv7 binaries
+		return ArchArmv7l
+	case "armv6", "armv6hl", "armel":
+		return ArchArmv6l
+	case "ppc64el", "ppc64-le":
+		return ArchPpc64le
+	case "loong64":
+		return ArchLoongarch64
+	}
+	return Arch(name)
+}
+
+// Go returns the GOARCH and, for 32-bit ARM, GOARM values for a.
+func (a Arch) Go() (goarch, goarm string) {
+	if n, ok := archNames[a]; ok {
+		return n.goarch, n.goarm
+	}
+	return string(a), ""
+}
+
+// Debian returns the dpkg architecture name, e.g., "amd64", "armhf".
+func (a Arch) Debian() string {
+	if n, ok := archNames[a]; ok {
+		return n.debian
+	}
+	return string(a)
+}
+
+// RPM returns the rpm architecture name, e.g., "x86_64", "armv7hl".
+func (a Arch) RPM() string {
+	if n, ok := archNames[a]; ok {
+		return n.rpm
+	}
+	return string(a)
+}
+
+// Asset returns the name commonly used in release asset file names, as
+// produced by GoReleaser, e.g., "amd64", "arm64", "armv7".
+func (a Arch) Asset() string {
+	if n, ok := archNames[a]; ok {
+		return n.asset
+	}
+	return string(a)
+}
+
+// MachineArch returns the host's CPU architecture.
+func MachineArch() Arch {
+	return defaultDetector.MachineArch()
+}
+
+// MachineArch returns the CPU architecture reported by the kernel, which
+// may differ from runtime.GOARCH, e.g., for a 386 binary on x86_64. It
+// tries uname(2), then /proc/sys/kernel/arch, then the hardware
+// capabilities in /proc/self/auxv to tell armv6 from armv7.
+//
+// For a detector with another root, the running kernel says nothing about
+// the root's binaries, so the architecture is taken from ARCHITECTURE in
+// its os-release or from the ELF header of its /bin/sh. An empty Arch
+// means neither was found.
+func (d *Detector) MachineArch() Arch {
+	if machine, _, err := d.uname(); err == nil && machine != "" {
+		return ParseArch(machine)
+	}
+	if d.Root != "/" {
+		return d.rootArch()
+	}
+	if data, err := d.readFile("/proc/sys/kernel/arch"); err == nil {
+		if machine := strings.TrimSpace(string(data)); machine != "" {
+			return ParseArch(machine)
+		}
+	}
+
+	if runtime.GOARCH == "arm" {
+		return d.armArch()
+	}
+	return ParseArch(runtime.GOARCH)
+}
+
+// rootArch returns the architecture of the detector's root filesystem.
+func (d *Detector) rootArch() Arch {
+	if info, err := d.readOSRelease(); err == nil && info.Architecture != "" {
+		return ParseArch(info.Architecture)
+	}
+
+	// Follow /bin/sh within the root, e.g., to /bin/busybox on Alpine
+	name := "/bin/sh"
+	for i := 0; i < 8; i++ {
+		target, err := d.readLink(name)
+		if err != nil {
+			break
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(name), target)
+		}
+		name = target
+	}
+	file, err := d.open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	header := make([]byte, 64)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return ""
+	}
+	return elfArch(header)
+}
+
+// ELF header offsets and the ARM hard-float flag from elf.h.
+const (
+	elfMachineOffset  = 0x12
+	elfFlags32Offset  = 0x24
+	efARMABIFloatHard = 0x400
+)
+
+// elfArch returns the architecture of an executable from its ELF header,
+// or an empty Arch. 32-bit ARM binaries built for the hard-float ABI are
+// taken as armv7, the baseline of Debian's armhf, and the rest as armv6.
+func elfArch(header []byte) Arch {
+	if len(header) < elfFlags32Offset+4 || string(header[:4]) != elf.ELFMAG {
+		return ""
+	}
+	class := elf.Class(header[elf.EI_CLASS])
+	var order binary.ByteOrder = binary.LittleEndian
+	if elf.Data(header[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+
+	switch elf.Machine(order.Uint16(header[elfMachineOffset:])) {
+	case elf.EM_X86_64:
+		return ArchX86_64
+	case elf.EM_386:
+		return ArchI686
+	case elf.EM_AARCH64:
+		return ArchAarch64
+	case elf.EM_ARM:
+		if order.Uint32(header[elfFlags32Offset:])&efARMABIFloatHard != 0 {
+			return ArchArmv7l
+		}
+		return ArchArmv6l
+	case elf.EM_RISCV:
+		if class == elf.ELFCLASS64 {
+			return ArchRiscv64
+		}
+	case elf.EM_PPC64:
+		if order == binary.LittleEndian {
+			return ArchPpc64le
+		}
+	case elf.EM_S390:
+		if class == elf.ELFCLASS64 {
+			return ArchS390x
+		}
+	case elf.EM_LOONGARCH:
+		return ArchLoongarch64
+	}
+	return ""
+}
+
+// Auxiliary vector entries and ARM hardware capabilities from linux/auxvec.h
+// and arch/arm/include/uapi/asm/hwcap.h.
+const (
+	atHWCap      = 16
+	hwcapARMVFP3 = 1 << 13
+)
+
+// armArch distinguishes armv7 from armv6 by VFPv3 support, which armhf
+// requires, in the auxiliary vector of this 32-bit process.
+func (d *Detector) armArch() Arch {
+	data, err := d.readFile("/proc/self/auxv")
+	if err != nil {
+		return ArchArmv7l
+	}
+
+	// Pairs of native words: type, value
+	word := strconv.IntSize / 8
+	for i := 0; i+2*word <= len(data); i += 2 * word {
+		key, value := auxvWord(data[i:], word), auxvWord(data[i+word:], word)
+		if key == atHWCap {
+			if value&hwcapARMVFP3 != 0 {
+				return ArchArmv7l
+			}
+			return ArchArmv6l
+		}
+	}
+	return ArchArmv7l
+}
+
+func auxvWord(b []byte, size int) uint64 {
+	if size == 4 {
+		return uint64(binary.LittleEndian.Uint32(b))
+	}
+	return binary.LittleEndian.Uint64(b)
+}
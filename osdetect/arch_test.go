@@ -0,0 +1,138 @@
+package osdetect
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseArch(t *testing.T) {
+	tests := []struct {
+		name string
+		want Arch
+	}{
+		{"x86_64", ArchX86_64},
+		{"amd64", ArchX86_64},
+		{"x86-64", ArchX86_64},
+		{"i686", ArchI686},
+		{"i386", ArchI686},
+		{"aarch64", ArchAarch64},
+		{"arm64", ArchAarch64},
+		{"armv7l", ArchArmv7l},
+		{"armhf", ArchArmv7l},
+		{"armv8l", ArchArmv7l},
+		{"armv6l", ArchArmv6l},
+		{"armel", ArchArmv6l},
+		{"ppc64el", ArchPpc64le},
+		{" MIPS64 ", "mips64"},
+	}
+	for _, tt := range tests {
+		if got := ParseArch(tt.name); got != tt.want {
+			t.Errorf("ParseArch(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestArchNames(t *testing.T) {
+	tests := []struct {
+		arch                      Arch
+		asset, debian, rpm, goarm string
+	}{
+		{ArchX86_64, "amd64", "amd64", "x86_64", ""},
+		{ArchI686, "386", "i386", "i686", ""},
+		{ArchAarch64, "arm64", "arm64", "aarch64", ""},
+		{ArchArmv7l, "armv7", "armhf", "armv7hl", "7"},
+		{ArchArmv6l, "armv6", "armel", "armv6hl", "6"},
+		{"mips64", "mips64", "mips64", "mips64", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.arch.Asset(); got != tt.asset {
+			t.Errorf("%s.Asset() = %q, want %q", tt.arch, got, tt.asset)
+		}
+		if got := tt.arch.Debian(); got != tt.debian {
+			t.Errorf("%s.Debian() = %q, want %q", tt.arch, got, tt.debian)
+		}
+		if got := tt.arch.RPM(); got != tt.rpm {
+			t.Errorf("%s.RPM() = %q, want %q", tt.arch, got, tt.rpm)
+		}
+		if _, goarm := tt.arch.Go(); goarm != tt.goarm {
+			t.Errorf("%s.Go() goarm = %q, want %q", tt.arch, goarm, tt.goarm)
+		}
+	}
+}
+
+// elfHeader returns the start of a little-endian 32- or 64-bit ELF
+// executable for machine with the given flags.
+func elfHeader(class byte, machine uint16, flags uint32) []byte {
+	h := make([]byte, 64)
+	copy(h, "\x7fELF")
+	h[4], h[5], h[6] = class, 1, 1
+	binary.LittleEndian.PutUint16(h[0x10:], 2) // ET_EXEC
+	binary.LittleEndian.PutUint16(h[0x12:], machine)
+	if class == 1 {
+		binary.LittleEndian.PutUint32(h[0x24:], flags)
+	} else {
+		binary.LittleEndian.PutUint32(h[0x30:], flags)
+	}
+	return h
+}
+
+func TestMachineArchForeignRoot(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  Arch
+	}{
+		{
+			name: "os-release",
+			files: fstest.MapFS{
+				"etc/os-release": {Data: []byte("ID=fedora\nARCHITECTURE=arm64\n")},
+				"bin/sh":         {Data: elfHeader(2, 62, 0)},
+			},
+			want: ArchAarch64,
+		},
+		{
+			name:  "x86_64 shell",
+			files: fstest.MapFS{"bin/sh": {Data: elfHeader(2, 62, 0)}},
+			want:  ArchX86_64,
+		},
+		{
+			name:  "armhf shell",
+			files: fstest.MapFS{"bin/sh": {Data: elfHeader(1, 40, 0x05000400)}},
+			want:  ArchArmv7l,
+		},
+		{
+			name:  "armel shell",
+			files: fstest.MapFS{"bin/sh": {Data: elfHeader(1, 40, 0x05000200)}},
+			want:  ArchArmv6l,
+		},
+		{
+			// The running kernel does not describe the root
+			name:  "unknown",
+			files: fstest.MapFS{"proc/sys/kernel/arch": {Data: []byte("x86_64\n")}},
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewDetector(tt.files).MachineArch(); got != tt.want {
+				t.Errorf("MachineArch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMachineArchFollowsShellLink(t *testing.T) {
+	// Alpine's /bin/sh is an absolute link to busybox, which must resolve
+	// within the root rather than on the host
+	root := t.TempDir()
+	writeTestFile(t, root, "bin/busybox", string(elfHeader(2, 183, 0)))
+	if err := os.Symlink("/bin/busybox", filepath.Join(root, "bin/sh")); err != nil {
+		t.Fatal(err)
+	}
+	if got := NewRootDetector(root).MachineArch(); got != ArchAarch64 {
+		t.Errorf("MachineArch() = %q, want %q", got, ArchAarch64)
+	}
+}
@@ -0,0 +1,371 @@
+package osdetect
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSetcap is returned when file capabilities are needed but the libcap tools are missing.
+var ErrNoSetcap = errors.New("setcap and getcap not found; install libcap2-bin (Debian, Ubuntu) or libcap (Alpine, Fedora, Arch)")
+
+// Capability is a Linux capability, numbered as in linux/capability.h.
+type Capability uint
+
+const (
+	CapChown Capability = iota
+	CapDacOverride
+	CapDacReadSearch
+	CapFowner
+	CapFsetid
+	CapKill
+	CapSetgid
+	CapSetuid
+	CapSetpcap
+	CapLinuxImmutable
+	CapNetBindService // Bind ports below 1024
+	CapNetBroadcast
+	CapNetAdmin // Configure interfaces, routes and firewalls
+	CapNetRaw   // Raw and packet sockets
+	CapIpcLock
+	CapIpcOwner
+	CapSysModule
+	CapSysRawio
+	CapSysChroot
+	CapSysPtrace
+	CapSysPacct
+	CapSysAdmin
+	CapSysBoot
+	CapSysNice
+	CapSysResource
+	CapSysTime
+	CapSysTtyConfig
+	CapMknod
+	CapLease
+	CapAuditWrite
+	CapAuditControl
+	CapSetfcap
+	CapMacOverride
+	CapMacAdmin
+	CapSyslog
+	CapWakeAlarm
+	CapBlockSuspend
+	CapAuditRead
+	CapPerfmon
+	CapBpf
+	CapCheckpointRestore
+)
+
+var capabilityNames = []string{
+	"chown", "dac_override", "dac_read_search", "fowner", "fsetid", "kill",
+	"setgid", "setuid", "setpcap", "linux_immutable", "net_bind_service",
+	"net_broadcast", "net_admin", "net_raw", "ipc_lock", "ipc_owner",
+	"sys_module", "sys_rawio", "sys_chroot", "sys_ptrace", "sys_pacct",
+	"sys_admin", "sys_boot", "sys_nice", "sys_resource", "sys_time",
+	"sys_tty_config", "mknod", "lease", "audit_write", "audit_control",
+	"setfcap", "mac_override", "mac_admin", "syslog", "wake_alarm",
+	"block_suspend", "audit_read", "perfmon", "bpf", "checkpoint_restore",
+}
+
+// String returns the name used by setcap and getcap, e.g., "cap_net_bind_service".
+func (c Capability) String() string {
+	if int(c) < len(capabilityNames) {
+		return "cap_" + capabilityNames[c]
+	}
+	return "cap_" + strconv.Itoa(int(c))
+}
+
+// ParseCapability parses a capability name such as "CAP_NET_ADMIN",
+// "cap_net_admin" or "net_admin".
+func ParseCapability(name string) (Capability, error) {
+	short := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "cap_")
+	for i, n := range capabilityNames {
+		if n == short {
+			return Capability(i), nil
+		}
+	}
+	// Capabilities newer than this list are printed by number
+	if n, err := strconv.Atoi(short); err == nil && n >= 0 && n < 64 {
+		return Capability(n), nil
+	}
+	return 0, fmt.Errorf("unknown capability '%s'", name)
+}
+
+// CapabilitySet is a set of capabilities as a bit mask, as in /proc/<pid>/status.
+type CapabilitySet uint64
+
+// allCapabilities is every capability this package knows by name.
+const allCapabilities = CapabilitySet(1)<<(CapCheckpointRestore+1) - 1
+
+// NewCapabilitySet returns the set containing caps.
+func NewCapabilitySet(caps ...Capability) CapabilitySet {
+	var s CapabilitySet
+	for _, c := range caps {
+		s |= 1 << c
+	}
+	return s
+}
+
+// Has reports whether s contains all of caps.
+func (s CapabilitySet) Has(caps ...Capability) bool {
+	want := NewCapabilitySet(caps...)
+	return s&want == want
+}
+
+// List returns the capabilities in s in numeric order.
+func (s CapabilitySet) List() []Capability {
+	var caps []Capability
+	for s != 0 {
+		c := bits.TrailingZeros64(uint64(s))
+		caps = append(caps, Capability(c))
+		s &^= 1 << c
+	}
+	return caps
+}
+
+// String returns the capabilities as a comma-separated list, e.g., "cap_net_admin,cap_net_raw".
+func (s CapabilitySet) String() string {
+	var names []string
+	for _, c := range s.List() {
+		names = append(names, c.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// ProcessCapabilities are the capability sets of a process.
+type ProcessCapabilities struct {
+	Effective   CapabilitySet // Checked by the kernel for privileged operations
+	Permitted   CapabilitySet // Upper bound on Effective
+	Inheritable CapabilitySet
+	Bounding    CapabilitySet // Upper bound on capabilities gained through execve
+	Ambient     CapabilitySet // Kept across execve of unprivileged programs
+}
+
+// CurrentCapabilities returns the capabilities of the current process.
+func CurrentCapabilities() (*ProcessCapabilities, error) {
+	return defaultDetector.CurrentCapabilities()
+}
+
+// CurrentCapabilities reads the capability sets in /proc/self/status.
+func (d *Detector) CurrentCapabilities() (*ProcessCapabilities, error) {
+	file, err := d.open("/proc/self/status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read process capabilities: %w", err)
+	}
+	defer file.Close()
+
+	caps := &ProcessCapabilities{}
+	sets := map[string]*CapabilitySet{
+		"CapInh": &caps.Inheritable,
+		"CapPrm": &caps.Permitted,
+		"CapEff": &caps.Effective,
+		"CapBnd": &caps.Bounding,
+		"CapAmb": &caps.Ambient,
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		set, found := sets[key]
+		if !ok || !found {
+			continue
+		}
+		mask, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in /proc/self/status: %w", key, err)
+		}
+		*set = CapabilitySet(mask)
+	}
+	return caps, scanner.Err()
+}
+
+// CapabilityError is returned by RequireCapabilities when the process
+// lacks capabilities.
+type CapabilityError struct {
+	Missing CapabilitySet
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("missing capabilities %s; run as root or grant them with setcap", e.Missing)
+}
+
+// RequireCapabilities returns *CapabilityError unless the current process
+// has all of caps in its effective set.
+func RequireCapabilities(caps ...Capability) error {
+	return defaultDetector.RequireCapabilities(caps...)
+}
+
+// RequireCapabilities returns *CapabilityError unless the process has all
+// of caps in its effective set. Unlike RequireRoot, it accepts unprivileged
+// processes granted only what they need, e.g., CapNetBindService to bind
+// port 53.
+func (d *Detector) RequireCapabilities(caps ...Capability) error {
+	current, err := d.CurrentCapabilities()
+	if err != nil {
+		return err
+	}
+	if missing := NewCapabilitySet(caps...) &^ current.Effective; missing != 0 {
+		return &CapabilityError{Missing: missing}
+	}
+	return nil
+}
+
+// FileCapabilities are the capabilities stored on an executable, which
+// a process gains when it runs it.
+type FileCapabilities struct {
+	Permitted   CapabilitySet
+	Inheritable CapabilitySet
+	Effective   bool // Permitted capabilities are also effective at execve
+}
+
+// String returns the capabilities in setcap's format, e.g., "cap_net_bind_service=ep".
+func (f *FileCapabilities) String() string {
+	var clauses []string
+	if f.Permitted != 0 {
+		flags := "p"
+		if f.Effective {
+			flags = "ep"
+		}
+		clauses = append(clauses, f.Permitted.String()+"="+flags)
+	}
+	if f.Inheritable != 0 {
+		clauses = append(clauses, f.Inheritable.String()+"+i")
+	}
+	return strings.Join(clauses, " ")
+}
+
+// GetFileCapabilities returns the capabilities set on an executable on the host.
+func GetFileCapabilities(ctx context.Context, name string) (*FileCapabilities, error) {
+	return defaultDetector.GetFileCapabilities(ctx, name)
+}
+
+// GetFileCapabilities returns the capabilities set on file name with
+// getcap, which are empty if it has none.
+func (d *Detector) GetFileCapabilities(ctx context.Context, name string) (*FileCapabilities, error) {
+	if !d.hasCommand("getcap") {
+		return nil, ErrNoSetcap
+	}
+	res, err := d.runner().Run(ctx, Query("getcap", name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get capabilities of %s: %w", name, err)
+	}
+
+	// "/usr/bin/ping cap_net_raw=ep", or "/usr/bin/ping = cap_net_raw+ep" from libcap < 2.41
+	out := strings.TrimSpace(string(res.Stdout))
+	text := strings.TrimSpace(strings.TrimPrefix(out, name))
+	text = strings.TrimSpace(strings.TrimPrefix(text, "= "))
+	return parseCapabilityText(text)
+}
+
+// SetFileCapabilities grants capabilities to an executable on the host.
+func SetFileCapabilities(ctx context.Context, name string, caps ...Capability) error {
+	return defaultDetector.SetFileCapabilities(ctx, name, caps...)
+}
+
+// SetFileCapabilities replaces the capabilities of file name with caps, as
+// permitted and effective, using setcap. Replacing the file, e.g., when
+// upgrading the binary, drops them. With no caps, it removes them.
+func (d *Detector) SetFileCapabilities(ctx context.Context, name string, caps ...Capability) error {
+	if !d.hasCommand("setcap") {
+		return ErrNoSetcap
+	}
+	if len(caps) == 0 {
+		return d.RemoveFileCapabilities(ctx, name)
+	}
+
+	current, err := d.GetFileCapabilities(ctx, name)
+	if err != nil {
+		return err
+	}
+	want := NewCapabilitySet(caps...)
+	if current.Permitted == want && current.Effective && current.Inheritable == 0 {
+		return nil
+	}
+
+	if _, err := d.runner().Run(ctx, Command("setcap", want.String()+"=ep", name)); err != nil {
+		return fmt.Errorf("failed to set capabilities of %s: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveFileCapabilities removes all capabilities from an executable on the host.
+func RemoveFileCapabilities(ctx context.Context, name string) error {
+	return defaultDetector.RemoveFileCapabilities(ctx, name)
+}
+
+// RemoveFileCapabilities removes all capabilities from file name. Removing
+// capabilities from a file that has none is a no-op.
+func (d *Detector) RemoveFileCapabilities(ctx context.Context, name string) error {
+	current, err := d.GetFileCapabilities(ctx, name)
+	if err != nil {
+		return err
+	}
+	if current.Permitted == 0 && current.Inheritable == 0 {
+		return nil
+	}
+	if _, err := d.runner().Run(ctx, Command("setcap", "-r", name)); err != nil {
+		return fmt.Errorf("failed to remove capabilities of %s: %w", name, err)
+	}
+	return nil
+}
+
+// parseCapabilityText parses capabilities in the text form of
+// cap_from_text(3), e.g., "cap_net_admin,cap_net_raw+ep cap_sys_time=i".
+func parseCapabilityText(text string) (*FileCapabilities, error) {
+	f := &FileCapabilities{}
+	var effective CapabilitySet
+	for _, clause := range strings.Fields(text) {
+		i := strings.IndexAny(clause, "=+-")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid capabilities '%s'", text)
+		}
+
+		// An empty list or "all" means every capability
+		set := allCapabilities
+		if names := clause[:i]; names != "" && names != "all" {
+			set = 0
+			for _, name := range strings.Split(names, ",") {
+				c, err := ParseCapability(name)
+				if err != nil {
+					return nil, err
+				}
+				set |= 1 << c
+			}
+		}
+
+		op := byte(0)
+		for _, ch := range clause[i:] {
+			var target *CapabilitySet
+			switch ch {
+			case '=', '+', '-':
+				op = byte(ch)
+				if op == '=' {
+					f.Permitted &^= set
+					f.Inheritable &^= set
+					effective &^= set
+				}
+				continue
+			case 'p':
+				target = &f.Permitted
+			case 'i':
+				target = &f.Inheritable
+			case 'e':
+				target = &effective
+			default:
+				return nil, fmt.Errorf("invalid capabilities '%s'", text)
+			}
+			if op == '-' {
+				*target &^= set
+			} else {
+				*target |= set
+			}
+		}
+	}
+
+	// Files have a single effective bit that applies to all permitted capabilities
+	f.Effective = effective != 0
+	return f, nil
+}
@@ -0,0 +1,147 @@
+package osdetect
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseCapabilityText(t *testing.T) {
+	tests := []struct {
+		text string
+		want FileCapabilities
+	}{
+		{"cap_net_bind_service=+ep", FileCapabilities{Permitted: NewCapabilitySet(CapNetBindService), Effective: true}},
+		{"cap_net_bind_service=ep", FileCapabilities{Permitted: NewCapabilitySet(CapNetBindService), Effective: true}},
+		{"cap_net_admin,cap_net_raw+eip", FileCapabilities{
+			Permitted:   NewCapabilitySet(CapNetAdmin, CapNetRaw),
+			Inheritable: NewCapabilitySet(CapNetAdmin, CapNetRaw),
+			Effective:   true,
+		}},
+		{"cap_net_raw=p cap_sys_time+i", FileCapabilities{Permitted: NewCapabilitySet(CapNetRaw), Inheritable: NewCapabilitySet(CapSysTime)}},
+		{"cap_net_admin,cap_net_raw=ep cap_net_raw-e", FileCapabilities{Permitted: NewCapabilitySet(CapNetAdmin, CapNetRaw), Effective: true}},
+		{"=ep cap_sys_admin-ep", FileCapabilities{Permitted: allCapabilities &^ NewCapabilitySet(CapSysAdmin), Effective: true}},
+		{"cap_41=p", FileCapabilities{Permitted: 1 << 41}},
+		{"", FileCapabilities{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := parseCapabilityText(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("parseCapabilityText(%q) = %+v, want %+v", tt.text, *got, tt.want)
+			}
+		})
+	}
+
+	for _, text := range []string{"cap_net_raw", "cap_bogus=ep", "cap_net_raw=x"} {
+		if _, err := parseCapabilityText(text); err == nil {
+			t.Errorf("parseCapabilityText(%q) succeeded", text)
+		}
+	}
+}
+
+func TestGetFileCapabilities(t *testing.T) {
+	tests := []struct {
+		name   string
+		stdout string
+		want   FileCapabilities
+	}{
+		{"libcap 2.41+", "/usr/bin/myapp cap_net_bind_service=ep\n", FileCapabilities{Permitted: NewCapabilitySet(CapNetBindService), Effective: true}},
+		{"libcap < 2.41", "/usr/bin/myapp = cap_net_admin,cap_net_raw+ep\n", FileCapabilities{Permitted: NewCapabilitySet(CapNetAdmin, CapNetRaw), Effective: true}},
+		{"none", "", FileCapabilities{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RecordingRunner{
+				Paths: map[string]string{"getcap": "/usr/sbin/getcap"},
+				Handler: func(Cmd) (*Result, error) {
+					return &Result{Stdout: []byte(tt.stdout)}, nil
+				},
+			}
+			d := NewDetector(fstest.MapFS{})
+			d.Runner = r
+
+			got, err := d.GetFileCapabilities(context.Background(), "/usr/bin/myapp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("GetFileCapabilities() = %+v, want %+v", *got, tt.want)
+			}
+			if cmds := r.CommandLines(); !reflect.DeepEqual(cmds, []string{"getcap /usr/bin/myapp"}) {
+				t.Errorf("commands = %q", cmds)
+			}
+		})
+	}
+
+	d := NewDetector(fstest.MapFS{})
+	d.Runner = &RecordingRunner{}
+	if _, err := d.GetFileCapabilities(context.Background(), "/usr/bin/myapp"); !errors.Is(err, ErrNoSetcap) {
+		t.Errorf("GetFileCapabilities() without getcap = %v, want ErrNoSetcap", err)
+	}
+}
+
+func TestSetFileCapabilities(t *testing.T) {
+	paths := map[string]string{"getcap": "/usr/sbin/getcap", "setcap": "/usr/sbin/setcap"}
+	for _, tt := range []struct {
+		current string
+		want    []string
+	}{
+		{"", []string{"getcap /usr/bin/myapp", "setcap cap_net_bind_service=ep /usr/bin/myapp"}},
+		{"/usr/bin/myapp cap_net_bind_service=ep", []string{"getcap /usr/bin/myapp"}},
+		{"/usr/bin/myapp cap_net_bind_service=p", []string{"getcap /usr/bin/myapp", "setcap cap_net_bind_service=ep /usr/bin/myapp"}},
+	} {
+		r := &RecordingRunner{Paths: paths, Handler: func(Cmd) (*Result, error) {
+			return &Result{Stdout: []byte(tt.current)}, nil
+		}}
+		d := NewDetector(fstest.MapFS{})
+		d.Runner = r
+		if err := d.SetFileCapabilities(context.Background(), "/usr/bin/myapp", CapNetBindService); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.CommandLines(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("current %q: commands = %q, want %q", tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestCurrentCapabilities(t *testing.T) {
+	d := NewDetector(fstest.MapFS{
+		"proc/self/status": {Data: []byte("Name:\tmyapp\n" +
+			"Uid:\t998\t998\t998\t998\n" +
+			"CapInh:\t0000000000000000\n" +
+			"CapPrm:\t0000000000000400\n" +
+			"CapEff:\t0000000000000400\n" +
+			"CapBnd:\t000001ffffffffff\n" +
+			"CapAmb:\t0000000000000400\n" +
+			"NoNewPrivs:\t1\n")},
+	})
+
+	got, err := d.CurrentCapabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ProcessCapabilities{
+		Effective: NewCapabilitySet(CapNetBindService),
+		Permitted: NewCapabilitySet(CapNetBindService),
+		Bounding:  allCapabilities,
+		Ambient:   NewCapabilitySet(CapNetBindService),
+	}
+	if *got != want {
+		t.Errorf("CurrentCapabilities() = %+v, want %+v", *got, want)
+	}
+
+	if err := d.RequireCapabilities(CapNetBindService); err != nil {
+		t.Errorf("RequireCapabilities(net_bind_service) = %v", err)
+	}
+	var capErr *CapabilityError
+	err = d.RequireCapabilities(CapNetBindService, CapNetAdmin)
+	if !errors.As(err, &capErr) || capErr.Missing != NewCapabilitySet(CapNetAdmin) {
+		t.Errorf("RequireCapabilities(net_bind_service, net_admin) = %v, want net_admin missing", err)
+	}
+}
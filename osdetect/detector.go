@@ -0,0 +1,110 @@
+package osdetect
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// Detector reads system information from a filesystem.
+// Every file is looked up relative to the root of FS, so a Detector can
+// inspect the running host, a mounted chroot or container image, or an
+// in-memory filesystem such as fstest.MapFS.
+type Detector struct {
+	FS     fs.FS
+	Root   string // Host directory FS is rooted at; files are written beneath it. Empty means read-only.
+	Runner Runner // Executes commands; defaults to ExecRunner if nil
+
+	// Getenv reads the environment of the inspected session; defaults to os.Getenv if nil.
+	Getenv func(key string) string
+}
+
+// NewDetector returns a Detector that reads all files from fsys.
+func NewDetector(fsys fs.FS) *Detector {
+	return &Detector{FS: fsys}
+}
+
+// NewRootDetector returns a Detector that reads and writes files beneath the host directory root.
+func NewRootDetector(root string) *Detector {
+	return &Detector{FS: os.DirFS(root), Root: root}
+}
+
+// defaultDetector reads from the host root filesystem and backs the package-level functions.
+var defaultDetector = NewRootDetector("/")
+
+// runner returns the detector's Runner, defaulting to ExecRunner.
+func (d *Detector) runner() Runner {
+	if d.Runner == nil {
+		return ExecRunner{}
+	}
+	return d.Runner
+}
+
+// dryRunner returns the detector's Runner if it describes changes instead
+// of making them, or nil.
+func (d *Detector) dryRunner() DryRunner {
+	if dr, ok := d.runner().(DryRunner); ok && dr.DryRun() {
+		return dr
+	}
+	return nil
+}
+
+// uname returns the machine and release fields of the running kernel. It
+// only describes the host, so it fails for a detector with another root.
+func (d *Detector) uname() (machine, release string, err error) {
+	if d.Root != "/" {
+		return "", "", errors.ErrUnsupported
+	}
+	return uname()
+}
+
+// getenv returns the value of the environment variable key.
+func (d *Detector) getenv(key string) string {
+	if d.Getenv == nil {
+		return os.Getenv(key)
+	}
+	return d.Getenv(key)
+}
+
+// hasCommand reports whether the executable name is on PATH.
+func (d *Detector) hasCommand(name string) bool {
+	_, err := d.runner().LookPath(name)
+	return err == nil
+}
+
+// open opens the file at the absolute path name within the detector's filesystem.
+func (d *Detector) open(name string) (fs.File, error) {
+	return d.FS.Open(fsPath(name))
+}
+
+// readFile reads the file at the absolute path name within the detector's filesystem.
+func (d *Detector) readFile(name string) ([]byte, error) {
+	return fs.ReadFile(d.FS, fsPath(name))
+}
+
+// readLink returns the target of the symbolic link name. Filesystems without
+// symlink support can only be read through a detector with a Root.
+func (d *Detector) readLink(name string) (string, error) {
+	if rl, ok := d.FS.(interface{ ReadLink(string) (string, error) }); ok {
+		return rl.ReadLink(fsPath(name))
+	}
+	if d.Root == "" {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+	}
+	path, err := d.hostPath(name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(path)
+}
+
+// fsPath converts an absolute path such as /etc/os-release to an fs.FS path.
+func fsPath(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
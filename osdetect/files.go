@@ -0,0 +1,144 @@
+package osdetect
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrReadOnly is returned when writing through a Detector that has no Root.
+var ErrReadOnly = errors.New("detector filesystem is read-only")
+
+// hostPath returns the host path of the absolute path name beneath the detector's Root.
+func (d *Detector) hostPath(name string) (string, error) {
+	if d.Root == "" {
+		return "", ErrReadOnly
+	}
+	return filepath.Join(d.Root, filepath.FromSlash(fsPath(name))), nil
+}
+
+// All changes to files go through the functions below, which describe the
+// change to a DryRunner instead of making it.
+
+// writeFile atomically replaces name with data, creating parent directories.
+// It reports whether the file changed; identical content is left untouched.
+func (d *Detector) writeFile(name string, data []byte, perm fs.FileMode) (bool, error) {
+	path, err := d.hostPath(name)
+	if err != nil {
+		return false, err
+	}
+
+	if existing, err := d.readFile(name); err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+	if dr := d.dryRunner(); dr != nil {
+		dr.Describe("write " + path)
+		return true, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeFile removes name, reporting whether it existed.
+func (d *Detector) removeFile(name string) (bool, error) {
+	path, err := d.hostPath(name)
+	if err != nil {
+		return false, err
+	}
+	if dr := d.dryRunner(); dr != nil {
+		if _, err := os.Lstat(path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return false, nil
+			}
+			return false, err
+		}
+		dr.Describe("remove " + path)
+		return true, nil
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// writeInPlace overwrites the existing file name with data without
+// replacing it, as files in /proc and /sys require.
+func (d *Detector) writeInPlace(name string, data []byte) error {
+	path, err := d.hostPath(name)
+	if err != nil {
+		return err
+	}
+	if dr := d.dryRunner(); dr != nil {
+		dr.Describe("write " + path)
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// symlink atomically points name at target, creating parent directories.
+// It reports whether the link changed; a link to target is left untouched.
+func (d *Detector) symlink(target, name string) (bool, error) {
+	path, err := d.hostPath(name)
+	if err != nil {
+		return false, err
+	}
+
+	if existing, err := os.Readlink(path); err == nil && existing == target {
+		return false, nil
+	}
+	if dr := d.dryRunner(); dr != nil {
+		dr.Describe("symlink " + path + " -> " + target)
+		return true, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,722 @@
+package osdetect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FirewallType identifies a firewall frontend.
+type FirewallType string
+
+const (
+	FirewallFirewalld FirewallType = "firewalld"
+	FirewallUFW       FirewallType = "ufw"
+	FirewallNftables  FirewallType = "nftables"
+	FirewallIptables  FirewallType = "iptables" // iptables and ip6tables
+	FirewallNone      FirewallType = "none"
+)
+
+// Protocol is a transport protocol for port rules.
+type Protocol string
+
+const (
+	TCP Protocol = "tcp"
+	UDP Protocol = "udp"
+)
+
+// RuleAction is the action a port rule applies.
+type RuleAction string
+
+const (
+	RuleAllow RuleAction = "allow"
+	RuleDeny  RuleAction = "deny"
+)
+
+// PortRule is an incoming port rule.
+type PortRule struct {
+	Port     int
+	Protocol Protocol
+	Action   RuleAction
+}
+
+func (r PortRule) String() string {
+	return fmt.Sprintf("%s %d/%s", r.Action, r.Port, r.Protocol)
+}
+
+// validate checks that the rule can be applied.
+func (r PortRule) validate() error {
+	if r.Port < 1 || r.Port > 65535 {
+		return fmt.Errorf("invalid port %d", r.Port)
+	}
+	if r.Protocol != TCP && r.Protocol != UDP {
+		return fmt.Errorf("invalid protocol '%s'", r.Protocol)
+	}
+	if r.Action != RuleAllow && r.Action != RuleDeny {
+		return fmt.Errorf("invalid action '%s'", r.Action)
+	}
+	return nil
+}
+
+// Firewall opens and closes ports on the active firewall. Rules are tagged
+// with an owner name so an application can list and remove only its own
+// rules on uninstall. Changes that would cut off the current SSH session
+// fail with *LockoutError.
+type Firewall interface {
+	// Type returns the firewall frontend in use.
+	Type() FirewallType
+	// Allow accepts incoming traffic to port, replacing any owned deny rule for it.
+	Allow(ctx context.Context, port int, proto Protocol) error
+	// Deny rejects incoming traffic to port, replacing any owned allow rule for it.
+	Deny(ctx context.Context, port int, proto Protocol) error
+	// Rules returns the rules created by this owner.
+	Rules(ctx context.Context) ([]PortRule, error)
+	// Remove deletes an owned rule.
+	Remove(ctx context.Context, rule PortRule) error
+	// RemoveAll deletes every owned rule and any supporting configuration.
+	// An allow rule for the SSH session's port is kept, and reported as
+	// *LockoutError once the other rules are removed.
+	RemoveAll(ctx context.Context) error
+}
+
+// ErrNoFirewall is returned when no supported firewall is active.
+var ErrNoFirewall = errors.New("no supported firewall detected")
+
+// ownerPattern matches the names applications tag their rules and files with.
+var ownerPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// DetectFirewall detects the host's active firewall.
+func DetectFirewall(ctx context.Context) FirewallType {
+	return defaultDetector.DetectFirewall(ctx)
+}
+
+// DetectFirewall detects the active firewall, preferring the frontends
+// (firewalld, ufw) over the packet filters they manage.
+func (d *Detector) DetectFirewall(ctx context.Context) FirewallType {
+	r := d.runner()
+
+	if d.hasCommand("firewall-cmd") {
+		res, err := r.Run(ctx, Query("firewall-cmd", "--state"))
+		if err == nil && strings.TrimSpace(string(res.Stdout)) == "running" {
+			return FirewallFirewalld
+		}
+	}
+	if d.hasCommand("ufw") {
+		res, err := r.Run(ctx, Query("ufw", "status"))
+		if err == nil && strings.HasPrefix(string(res.Stdout), "Status: active") {
+			return FirewallUFW
+		}
+	}
+
+	// Native nftables setups use inet tables; iptables-nft only creates ip/ip6 tables
+	if d.hasCommand("nft") {
+		if ruleset, err := d.nftRuleset(ctx); err == nil {
+			for _, obj := range ruleset {
+				if obj.Table != nil && obj.Table.Family == "inet" {
+					return FirewallNftables
+				}
+			}
+		}
+	}
+	if d.iptablesInUse(ctx) {
+		return FirewallIptables
+	}
+	if d.hasCommand("nft") {
+		return FirewallNftables
+	}
+	return FirewallNone
+}
+
+// iptablesInUse reports whether iptables is the host's packet filter. Rules
+// in the legacy backend are invisible to nft, so legacy iptables always
+// counts; iptables-nft counts only once it has rules or non-default policies.
+func (d *Detector) iptablesInUse(ctx context.Context) bool {
+	if !d.hasCommand("iptables") {
+		return false
+	}
+	r := d.runner()
+
+	res, err := r.Run(ctx, Query("iptables", "-V"))
+	if err == nil && strings.Contains(string(res.Stdout), "(legacy)") {
+		return true
+	}
+	res, err = r.Run(ctx, Query("iptables", "-S"))
+	if err != nil {
+		return false
+	}
+	for _, line := range parseLines(string(res.Stdout), nil) {
+		if fields := strings.Fields(line); len(fields) != 3 || fields[0] != "-P" || fields[2] != "ACCEPT" {
+			return true
+		}
+	}
+	return false
+}
+
+// NewFirewall returns a Firewall for the host's active firewall, tagging rules with owner.
+func NewFirewall(ctx context.Context, owner string) (Firewall, error) {
+	return defaultDetector.Firewall(ctx, owner)
+}
+
+// Firewall returns a Firewall for the active firewall, tagging rules with
+// owner. Owner may contain letters, digits, '-' and '_'.
+func (d *Detector) Firewall(ctx context.Context, owner string) (Firewall, error) {
+	if !ownerPattern.MatchString(owner) {
+		return nil, fmt.Errorf("invalid firewall owner '%s'", owner)
+	}
+
+	var b firewallBackend
+	switch d.DetectFirewall(ctx) {
+	case FirewallFirewalld:
+		b = firewalldBackend{d: d, owner: owner}
+	case FirewallUFW:
+		b = ufwBackend{d: d, owner: owner}
+	case FirewallNftables:
+		b = nftBackend{d: d, owner: owner}
+	case FirewallIptables:
+		b = iptablesBackend{d: d, owner: owner}
+	default:
+		return nil, ErrNoFirewall
+	}
+	// Not running under SSH leaves session nil, which permits every change
+	session, err := d.CurrentSSHSession()
+	if err != nil && !errors.Is(err, ErrNoSSHSession) {
+		return nil, err
+	}
+	return &ownedFirewall{b: b, session: session}, nil
+}
+
+// firewallBackend applies owned rules to one firewall frontend.
+type firewallBackend interface {
+	Type() FirewallType
+	add(ctx context.Context, rule PortRule) error
+	remove(ctx context.Context, rule PortRule) error
+	rules(ctx context.Context) ([]PortRule, error)
+	// cleanup removes supporting configuration once no rules remain.
+	cleanup(ctx context.Context) error
+}
+
+// ownedFirewall implements Firewall on top of a backend, keeping at most
+// one owned rule per port and protocol.
+type ownedFirewall struct {
+	b       firewallBackend
+	session *SSHSession // Session guarded against lockout, if any
+}
+
+func (f *ownedFirewall) Type() FirewallType {
+	return f.b.Type()
+}
+
+func (f *ownedFirewall) Allow(ctx context.Context, port int, proto Protocol) error {
+	return f.set(ctx, PortRule{Port: port, Protocol: proto, Action: RuleAllow})
+}
+
+func (f *ownedFirewall) Deny(ctx context.Context, port int, proto Protocol) error {
+	return f.set(ctx, PortRule{Port: port, Protocol: proto, Action: RuleDeny})
+}
+
+func (f *ownedFirewall) Rules(ctx context.Context) ([]PortRule, error) {
+	return f.b.rules(ctx)
+}
+
+func (f *ownedFirewall) Remove(ctx context.Context, rule PortRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+	if err := f.session.CheckRemoveRule(rule); err != nil {
+		return err
+	}
+	if err := f.b.remove(ctx, rule); err != nil {
+		return fmt.Errorf("failed to remove firewall rule '%s': %w", rule, err)
+	}
+	return nil
+}
+
+func (f *ownedFirewall) RemoveAll(ctx context.Context) error {
+	rules, err := f.b.rules(ctx)
+	if err != nil {
+		return err
+	}
+	// Keep a rule the session depends on, but remove the rest
+	var lockout error
+	for _, rule := range rules {
+		if err := f.session.CheckRemoveRule(rule); err != nil {
+			lockout = err
+			continue
+		}
+		if err := f.Remove(ctx, rule); err != nil {
+			return err
+		}
+	}
+	if lockout != nil {
+		return lockout
+	}
+	return f.b.cleanup(ctx)
+}
+
+// set applies rule, replacing any owned rule for the same port and protocol.
+func (f *ownedFirewall) set(ctx context.Context, rule PortRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+	if err := f.session.CheckAddRule(rule); err != nil {
+		return err
+	}
+
+	existing, err := f.b.rules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range existing {
+		if r.Port != rule.Port || r.Protocol != rule.Protocol {
+			continue
+		}
+		if r.Action == rule.Action {
+			return nil
+		}
+		if err := f.Remove(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	if err := f.b.add(ctx, rule); err != nil {
+		return fmt.Errorf("failed to add firewall rule '%s': %w", rule, err)
+	}
+	return nil
+}
+
+// ruleComment encodes an owned rule as a comment, e.g. "myapp:allow:udp:53".
+func ruleComment(owner string, rule PortRule) string {
+	return fmt.Sprintf("%s:%s:%s:%d", owner, rule.Action, rule.Protocol, rule.Port)
+}
+
+// parseRuleComment decodes a comment written by ruleComment for owner.
+func parseRuleComment(owner, comment string) (PortRule, bool) {
+	parts := strings.Split(strings.Trim(comment, `"`), ":")
+	if len(parts) != 4 || parts[0] != owner {
+		return PortRule{}, false
+	}
+	port, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return PortRule{}, false
+	}
+	rule := PortRule{Port: port, Protocol: Protocol(parts[2]), Action: RuleAction(parts[1])}
+	return rule, rule.validate() == nil
+}
+
+// appendRule appends rule to rules unless already present.
+func appendRule(rules []PortRule, rule PortRule) []PortRule {
+	for _, r := range rules {
+		if r == rule {
+			return rules
+		}
+	}
+	return append(rules, rule)
+}
+
+// ufwBackend manages rules with ufw, tagging them with a comment.
+type ufwBackend struct {
+	d     *Detector
+	owner string
+}
+
+func (ufwBackend) Type() FirewallType { return FirewallUFW }
+
+func (b ufwBackend) add(ctx context.Context, rule PortRule) error {
+	_, err := b.d.runner().Run(ctx, Command("ufw", string(rule.Action), ufwPort(rule), "comment", b.owner))
+	return err
+}
+
+func (b ufwBackend) remove(ctx context.Context, rule PortRule) error {
+	_, err := b.d.runner().Run(ctx, Command("ufw", "delete", string(rule.Action), ufwPort(rule)))
+	return err
+}
+
+func (b ufwBackend) rules(ctx context.Context) ([]PortRule, error) {
+	res, err := b.d.runner().Run(ctx, Query("ufw", "status"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows look like "53/udp (v6)   ALLOW   Anywhere (v6)   # owner"
+	var rules []PortRule
+	for _, line := range parseLines(string(res.Stdout), nil) {
+		spec, comment, ok := strings.Cut(line, "# ")
+		if !ok || strings.TrimSpace(comment) != b.owner {
+			continue
+		}
+		fields := strings.Fields(spec)
+		if len(fields) < 2 {
+			continue
+		}
+		portStr, proto, ok := strings.Cut(fields[0], "/")
+		if !ok {
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			continue
+		}
+
+		action := RuleAction(strings.ToLower(fields[1]))
+		if fields[1] == "(v6)" && len(fields) > 2 {
+			action = RuleAction(strings.ToLower(fields[2]))
+		}
+		rule := PortRule{Port: port, Protocol: Protocol(proto), Action: action}
+		if rule.validate() == nil {
+			rules = appendRule(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (ufwBackend) cleanup(context.Context) error { return nil }
+
+func ufwPort(rule PortRule) string {
+	return fmt.Sprintf("%d/%s", rule.Port, rule.Protocol)
+}
+
+// firewalldBackend opens ports through a firewalld service named after the
+// owner, and closes them through a second service, <owner>-deny, that a rich
+// rule rejects. firewalld cannot tag rich rules, so keeping the ports in
+// owned services leaves other rich rules alone. Changes are made to the
+// permanent configuration and then reloaded.
+type firewalldBackend struct {
+	d     *Detector
+	owner string
+}
+
+func (firewalldBackend) Type() FirewallType { return FirewallFirewalld }
+
+func (b firewalldBackend) add(ctx context.Context, rule PortRule) error {
+	service := b.service(rule.Action)
+
+	// Create the service on first use
+	if _, err := b.query(ctx, "--permanent", "--info-service="+service); isExitError(err) {
+		if err := b.run(ctx, "--permanent", "--new-service="+service); err != nil {
+			return err
+		}
+	}
+	if err := b.run(ctx, "--permanent", "--service="+service, "--add-port="+ufwPort(rule)); err != nil {
+		return err
+	}
+	if rule.Action == RuleDeny {
+		return b.cmd(ctx, "--permanent", "--add-rich-rule="+firewalldRichRule(service))
+	}
+	return b.cmd(ctx, "--permanent", "--add-service="+service)
+}
+
+func (b firewalldBackend) remove(ctx context.Context, rule PortRule) error {
+	return b.cmd(ctx, "--permanent", "--service="+b.service(rule.Action), "--remove-port="+ufwPort(rule))
+}
+
+func (b firewalldBackend) rules(ctx context.Context) ([]PortRule, error) {
+	var rules []PortRule
+	for _, action := range []RuleAction{RuleAllow, RuleDeny} {
+		res, err := b.query(ctx, "--permanent", "--service="+b.service(action), "--get-ports")
+		if isExitError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range strings.Fields(string(res.Stdout)) {
+			portStr, proto, _ := strings.Cut(spec, "/")
+			port, _ := strconv.Atoi(portStr)
+			rule := PortRule{Port: port, Protocol: Protocol(proto), Action: action}
+			if rule.validate() == nil {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules, nil
+}
+
+func (b firewalldBackend) cleanup(ctx context.Context) error {
+	changed := false
+	for _, action := range []RuleAction{RuleAllow, RuleDeny} {
+		service := b.service(action)
+		if _, err := b.query(ctx, "--permanent", "--info-service="+service); isExitError(err) {
+			continue
+		}
+		unhook := "--remove-service=" + service
+		if action == RuleDeny {
+			unhook = "--remove-rich-rule=" + firewalldRichRule(service)
+		}
+		if err := b.run(ctx, "--permanent", unhook); err != nil && !isExitError(err) {
+			return err
+		}
+		if err := b.run(ctx, "--permanent", "--delete-service="+service); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return b.run(ctx, "--reload")
+}
+
+// service returns the name of the owner's service holding rules with action.
+func (b firewalldBackend) service(action RuleAction) string {
+	if action == RuleDeny {
+		return b.owner + "-deny"
+	}
+	return b.owner
+}
+
+// cmd runs firewall-cmd with args and reloads the permanent configuration.
+func (b firewalldBackend) cmd(ctx context.Context, args ...string) error {
+	if err := b.run(ctx, args...); err != nil {
+		return err
+	}
+	return b.run(ctx, "--reload")
+}
+
+func (b firewalldBackend) run(ctx context.Context, args ...string) error {
+	_, err := b.d.runner().Run(ctx, Command("firewall-cmd", args...))
+	return err
+}
+
+// query runs a read-only firewall-cmd.
+func (b firewalldBackend) query(ctx context.Context, args ...string) (*Result, error) {
+	return b.d.runner().Run(ctx, Query("firewall-cmd", args...))
+}
+
+// firewalldRichRule returns the rich rule that rejects the ports of service.
+func firewalldRichRule(service string) string {
+	return fmt.Sprintf(`rule service name="%s" reject`, service)
+}
+
+// iptablesBackend manages rules in the INPUT chain of iptables and, if
+// available, ip6tables, tagging them with the comment match. Rules are not
+// persisted across reboots.
+type iptablesBackend struct {
+	d     *Detector
+	owner string
+}
+
+func (iptablesBackend) Type() FirewallType { return FirewallIptables }
+
+func (b iptablesBackend) add(ctx context.Context, rule PortRule) error {
+	for _, bin := range b.binaries() {
+		if _, err := b.d.runner().Run(ctx, Command(bin, append([]string{"-I"}, b.spec(rule)...)...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b iptablesBackend) remove(ctx context.Context, rule PortRule) error {
+	for _, bin := range b.binaries() {
+		// The rule may already be gone from one family; -C exits 1 only
+		// if it is missing, and with other codes for permission or
+		// chain errors
+		_, err := b.d.runner().Run(ctx, Query(bin, append([]string{"-C"}, b.spec(rule)...)...))
+		var exitErr *ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode == 1 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := b.d.runner().Run(ctx, Command(bin, append([]string{"-D"}, b.spec(rule)...)...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b iptablesBackend) rules(ctx context.Context) ([]PortRule, error) {
+	var rules []PortRule
+	for _, bin := range b.binaries() {
+		res, err := b.d.runner().Run(ctx, Query(bin, "-S", "INPUT"))
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range parseLines(string(res.Stdout), nil) {
+			fields := strings.Fields(line)
+			for i, field := range fields {
+				if field != "--comment" || i+1 >= len(fields) {
+					continue
+				}
+				if rule, ok := parseRuleComment(b.owner, fields[i+1]); ok {
+					rules = appendRule(rules, rule)
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+func (iptablesBackend) cleanup(context.Context) error { return nil }
+
+// binaries returns the iptables commands to apply rules with.
+func (b iptablesBackend) binaries() []string {
+	bins := []string{"iptables"}
+	if b.d.hasCommand("ip6tables") {
+		bins = append(bins, "ip6tables")
+	}
+	return bins
+}
+
+// spec returns the iptables rule specification for rule.
+func (b iptablesBackend) spec(rule PortRule) []string {
+	target := "ACCEPT"
+	if rule.Action == RuleDeny {
+		target = "DROP"
+	}
+	return []string{
+		"INPUT",
+		"-p", string(rule.Protocol),
+		"--dport", strconv.Itoa(rule.Port),
+		"-m", "comment", "--comment", ruleComment(b.owner, rule),
+		"-j", target,
+	}
+}
+
+// nftBackend inserts rules into every input hook chain of the ruleset,
+// tagging them with a comment. If no input chain exists, it creates a table
+// named after the owner. Rules are not persisted across reboots.
+type nftBackend struct {
+	d     *Detector
+	owner string
+}
+
+func (nftBackend) Type() FirewallType { return FirewallNftables }
+
+// nftObject is an entry in the output of `nft -j list ruleset`.
+type nftObject struct {
+	Table *struct {
+		Family string `json:"family"`
+		Name   string `json:"name"`
+	} `json:"table"`
+	Chain *struct {
+		Family string `json:"family"`
+		Table  string `json:"table"`
+		Name   string `json:"name"`
+		Type   string `json:"type"`
+		Hook   string `json:"hook"`
+	} `json:"chain"`
+	Rule *struct {
+		Family  string `json:"family"`
+		Table   string `json:"table"`
+		Chain   string `json:"chain"`
+		Handle  int    `json:"handle"`
+		Comment string `json:"comment"`
+	} `json:"rule"`
+}
+
+// nftRuleset returns the parsed nftables ruleset.
+func (d *Detector) nftRuleset(ctx context.Context) ([]nftObject, error) {
+	res, err := d.runner().Run(ctx, Query("nft", "-j", "list", "ruleset"))
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Nftables []nftObject `json:"nftables"`
+	}
+	if err := json.Unmarshal(res.Stdout, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse nft ruleset: %w", err)
+	}
+	return out.Nftables, nil
+}
+
+func (b nftBackend) add(ctx context.Context, rule PortRule) error {
+	ruleset, err := b.d.nftRuleset(ctx)
+	if err != nil {
+		return err
+	}
+
+	var chains [][3]string
+	for _, obj := range ruleset {
+		c := obj.Chain
+		if c == nil || c.Hook != "input" || c.Type != "filter" {
+			continue
+		}
+		if c.Family == "inet" || c.Family == "ip" || c.Family == "ip6" {
+			chains = append(chains, [3]string{c.Family, c.Table, c.Name})
+		}
+	}
+
+	if len(chains) == 0 {
+		if err := b.nft(ctx, "add", "table", "inet", b.owner); err != nil {
+			return err
+		}
+		if err := b.nft(ctx, "add", "chain", "inet", b.owner, "input",
+			"{ type filter hook input priority 0; policy accept; }"); err != nil {
+			return err
+		}
+		chains = append(chains, [3]string{"inet", b.owner, "input"})
+	}
+
+	verdict := "accept"
+	if rule.Action == RuleDeny {
+		verdict = "drop"
+	}
+	for _, c := range chains {
+		err := b.nft(ctx, "insert", "rule", c[0], c[1], c[2],
+			string(rule.Protocol), "dport", strconv.Itoa(rule.Port), verdict,
+			"comment", strconv.Quote(ruleComment(b.owner, rule)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b nftBackend) remove(ctx context.Context, rule PortRule) error {
+	ruleset, err := b.d.nftRuleset(ctx)
+	if err != nil {
+		return err
+	}
+	comment := ruleComment(b.owner, rule)
+	for _, obj := range ruleset {
+		r := obj.Rule
+		if r == nil || r.Comment != comment {
+			continue
+		}
+		if err := b.nft(ctx, "delete", "rule", r.Family, r.Table, r.Chain, "handle", strconv.Itoa(r.Handle)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b nftBackend) rules(ctx context.Context) ([]PortRule, error) {
+	ruleset, err := b.d.nftRuleset(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var rules []PortRule
+	for _, obj := range ruleset {
+		if obj.Rule == nil {
+			continue
+		}
+		if rule, ok := parseRuleComment(b.owner, obj.Rule.Comment); ok {
+			rules = appendRule(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (b nftBackend) cleanup(ctx context.Context) error {
+	ruleset, err := b.d.nftRuleset(ctx)
+	if err != nil {
+		return err
+	}
+	for _, obj := range ruleset {
+		if t := obj.Table; t != nil && t.Family == "inet" && t.Name == b.owner {
+			return b.nft(ctx, "delete", "table", "inet", b.owner)
+		}
+	}
+	return nil
+}
+
+func (b nftBackend) nft(ctx context.Context, args ...string) error {
+	_, err := b.d.runner().Run(ctx, Command("nft", args...))
+	return err
+}
@@ -0,0 +1,505 @@
+package osdetect
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// firewallDetector returns a detector outside any SSH session that runs
+// commands with r.
+func firewallDetector(r *RecordingRunner, env map[string]string) *Detector {
+	d := NewDetector(fstest.MapFS{})
+	d.Runner = r
+	d.Getenv = func(key string) string { return env[key] }
+	return d
+}
+
+// defaultPolicies is "iptables -S" output for an empty ruleset.
+const defaultPolicies = "-P INPUT ACCEPT\n-P FORWARD ACCEPT\n-P OUTPUT ACCEPT\n"
+
+// iptablesHandler answers "iptables -V" and "iptables -S" with version and
+// ruleset, and passes other commands to next if it is not nil.
+func iptablesHandler(version, ruleset string, next func(Cmd) (*Result, error)) func(Cmd) (*Result, error) {
+	return func(cmd Cmd) (*Result, error) {
+		switch {
+		case cmd.Name == "iptables" && cmd.Args[0] == "-V":
+			return &Result{Stdout: []byte(version + "\n")}, nil
+		case cmd.Name == "iptables" && cmd.Args[0] == "-S":
+			return &Result{Stdout: []byte(ruleset)}, nil
+		case next != nil:
+			return next(cmd)
+		}
+		return nil, nil
+	}
+}
+
+func TestDetectFirewall(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   map[string]string
+		handler func(Cmd) (*Result, error)
+		want    FirewallType
+	}{
+		{
+			name:  "firewalld running",
+			paths: map[string]string{"firewall-cmd": "/usr/bin/firewall-cmd", "iptables": "/usr/sbin/iptables"},
+			handler: func(Cmd) (*Result, error) {
+				return &Result{Stdout: []byte("running\n")}, nil
+			},
+			want: FirewallFirewalld,
+		},
+		{
+			name:  "ufw active",
+			paths: map[string]string{"firewall-cmd": "/usr/bin/firewall-cmd", "ufw": "/usr/sbin/ufw", "iptables": "/usr/sbin/iptables"},
+			handler: func(cmd Cmd) (*Result, error) {
+				if cmd.Name == "firewall-cmd" {
+					return &Result{ExitCode: 252, Stdout: []byte("not running\n")}, nil
+				}
+				return &Result{Stdout: []byte("Status: active\n")}, nil
+			},
+			want: FirewallUFW,
+		},
+		{
+			name:  "ufw inactive",
+			paths: map[string]string{"ufw": "/usr/sbin/ufw", "iptables": "/usr/sbin/iptables"},
+			handler: iptablesHandler("iptables v1.8.9 (nf_tables)", defaultPolicies, func(Cmd) (*Result, error) {
+				return &Result{Stdout: []byte("Status: inactive\n")}, nil
+			}),
+			want: FirewallNone,
+		},
+		{
+			name:  "native nftables",
+			paths: map[string]string{"nft": "/usr/sbin/nft", "iptables": "/usr/sbin/iptables"},
+			handler: func(Cmd) (*Result, error) {
+				return &Result{Stdout: []byte(`{"nftables": [{"metainfo": {}}, {"table": {"family": "inet", "name": "filter", "handle": 1}}]}`)}, nil
+			},
+			want: FirewallNftables,
+		},
+		{
+			name:  "iptables-nft with rules",
+			paths: map[string]string{"nft": "/usr/sbin/nft", "iptables": "/usr/sbin/iptables"},
+			handler: iptablesHandler("iptables v1.8.9 (nf_tables)", defaultPolicies+"-A INPUT -p tcp -m tcp --dport 80 -j ACCEPT\n", func(Cmd) (*Result, error) {
+				return &Result{Stdout: []byte(`{"nftables": [{"table": {"family": "ip", "name": "filter", "handle": 1}}]}`)}, nil
+			}),
+			want: FirewallIptables,
+		},
+		{
+			name:    "iptables-nft with a drop policy",
+			paths:   map[string]string{"iptables": "/usr/sbin/iptables"},
+			handler: iptablesHandler("iptables v1.8.9 (nf_tables)", "-P INPUT DROP\n-P FORWARD DROP\n-P OUTPUT ACCEPT\n", nil),
+			want:    FirewallIptables,
+		},
+		{
+			name:    "iptables-nft unused",
+			paths:   map[string]string{"nft": "/usr/sbin/nft", "iptables": "/usr/sbin/iptables"},
+			handler: iptablesHandler("iptables v1.8.9 (nf_tables)", defaultPolicies, nil),
+			want:    FirewallNftables,
+		},
+		{
+			// Legacy rules are invisible to nft
+			name:    "iptables-legacy",
+			paths:   map[string]string{"nft": "/usr/sbin/nft", "iptables": "/usr/sbin/iptables"},
+			handler: iptablesHandler("iptables v1.8.9 (legacy)", defaultPolicies, nil),
+			want:    FirewallIptables,
+		},
+		{
+			name: "none",
+			want: FirewallNone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := firewallDetector(&RecordingRunner{Handler: tt.handler, Paths: tt.paths}, nil)
+			if got := d.DetectFirewall(context.Background()); got != tt.want {
+				t.Errorf("DetectFirewall() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	d := firewallDetector(&RecordingRunner{}, nil)
+	if _, err := d.Firewall(context.Background(), "myapp"); !errors.Is(err, ErrNoFirewall) {
+		t.Errorf("Firewall() error = %v, want ErrNoFirewall", err)
+	}
+	if _, err := d.Firewall(context.Background(), "my app"); err == nil {
+		t.Error("Firewall accepted an owner with a space")
+	}
+}
+
+func TestFirewallAllowCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   map[string]string
+		handler func(Cmd) (*Result, error)
+		want    []string
+	}{
+		{
+			name:  "ufw",
+			paths: map[string]string{"ufw": "/usr/sbin/ufw"},
+			handler: func(Cmd) (*Result, error) {
+				return &Result{Stdout: []byte("Status: active\n")}, nil
+			},
+			want: []string{
+				"ufw status",
+				"ufw allow 53/udp comment myapp",
+			},
+		},
+		{
+			name:  "firewalld",
+			paths: map[string]string{"firewall-cmd": "/usr/bin/firewall-cmd"},
+			handler: func(cmd Cmd) (*Result, error) {
+				switch {
+				case cmd.Args[0] == "--state":
+					return &Result{Stdout: []byte("running\n")}, nil
+				case strings.HasPrefix(cmd.Args[len(cmd.Args)-1], "--info-service="),
+					strings.HasPrefix(cmd.Args[len(cmd.Args)-1], "--get-ports"):
+					return &Result{ExitCode: 101}, nil
+				}
+				return nil, nil
+			},
+			want: []string{
+				"firewall-cmd --permanent --service=myapp --get-ports",
+				"firewall-cmd --permanent --service=myapp-deny --get-ports",
+				"firewall-cmd --permanent --info-service=myapp",
+				"firewall-cmd --permanent --new-service=myapp",
+				"firewall-cmd --permanent --service=myapp --add-port=53/udp",
+				"firewall-cmd --permanent --add-service=myapp",
+				"firewall-cmd --reload",
+			},
+		},
+		{
+			name:    "iptables",
+			paths:   map[string]string{"iptables": "/usr/sbin/iptables", "ip6tables": "/usr/sbin/ip6tables"},
+			handler: iptablesHandler("iptables v1.8.9 (legacy)", defaultPolicies, nil),
+			want: []string{
+				"iptables -S INPUT",
+				"ip6tables -S INPUT",
+				"iptables -I INPUT -p udp --dport 53 -m comment --comment myapp:allow:udp:53 -j ACCEPT",
+				"ip6tables -I INPUT -p udp --dport 53 -m comment --comment myapp:allow:udp:53 -j ACCEPT",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RecordingRunner{Handler: tt.handler, Paths: tt.paths}
+			fw, err := firewallDetector(r, nil).Firewall(context.Background(), "myapp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Reset()
+
+			if err := fw.Allow(context.Background(), 53, UDP); err != nil {
+				t.Fatal(err)
+			}
+			if got := r.CommandLines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUFWRules(t *testing.T) {
+	status := `Status: active
+
+To                         Action      From
+--                         ------      ----
+22/tcp                     ALLOW       Anywhere
+53/udp                     ALLOW       Anywhere                   # myapp
+8080/tcp                   DENY        Anywhere                   # myapp
+9000/tcp                   ALLOW       Anywhere                   # other
+53/udp (v6)                ALLOW       Anywhere (v6)              # myapp
+`
+	r := &RecordingRunner{Handler: func(Cmd) (*Result, error) {
+		return &Result{Stdout: []byte(status)}, nil
+	}}
+	b := ufwBackend{d: firewallDetector(r, nil), owner: "myapp"}
+
+	got, err := b.rules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PortRule{
+		{Port: 53, Protocol: UDP, Action: RuleAllow},
+		{Port: 8080, Protocol: TCP, Action: RuleDeny},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rules() = %v, want %v", got, want)
+	}
+}
+
+func TestFirewalldRules(t *testing.T) {
+	// Another tool's untagged reject rule must be left alone
+	r := &RecordingRunner{Handler: func(cmd Cmd) (*Result, error) {
+		switch strings.Join(cmd.Args, " ") {
+		case "--permanent --service=myapp --get-ports":
+			return &Result{Stdout: []byte("53/udp 53/tcp\n")}, nil
+		case "--permanent --service=myapp-deny --get-ports":
+			return &Result{Stdout: []byte("9000/tcp\n")}, nil
+		case "--permanent --list-rich-rules":
+			return &Result{Stdout: []byte("rule port port=\"8080\" protocol=\"tcp\" reject\n" +
+				"rule service name=\"myapp-deny\" reject\n")}, nil
+		}
+		return nil, nil
+	}}
+	b := firewalldBackend{d: firewallDetector(r, nil), owner: "myapp"}
+
+	got, err := b.rules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PortRule{
+		{Port: 53, Protocol: UDP, Action: RuleAllow},
+		{Port: 53, Protocol: TCP, Action: RuleAllow},
+		{Port: 9000, Protocol: TCP, Action: RuleDeny},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rules() = %v, want %v", got, want)
+	}
+
+	r.Reset()
+	fw := &ownedFirewall{b: b}
+	if err := fw.RemoveAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range r.CommandLines() {
+		if strings.Contains(line, "8080") {
+			t.Errorf("RemoveAll touched a foreign rule: %s", line)
+		}
+	}
+	wantTail := []string{
+		"firewall-cmd --permanent --info-service=myapp",
+		"firewall-cmd --permanent --remove-service=myapp",
+		"firewall-cmd --permanent --delete-service=myapp",
+		"firewall-cmd --permanent --info-service=myapp-deny",
+		"firewall-cmd --permanent '--remove-rich-rule=rule service name=\"myapp-deny\" reject'",
+		"firewall-cmd --permanent --delete-service=myapp-deny",
+		"firewall-cmd --reload",
+	}
+	if got := r.CommandLines(); len(got) < len(wantTail) || !reflect.DeepEqual(got[len(got)-len(wantTail):], wantTail) {
+		t.Errorf("commands =\n%q\nwant them to end with\n%q", got, wantTail)
+	}
+}
+
+func TestIptablesRemove(t *testing.T) {
+	rule := PortRule{Port: 53, Protocol: UDP, Action: RuleAllow}
+	paths := map[string]string{"iptables": "/usr/sbin/iptables", "ip6tables": "/usr/sbin/ip6tables"}
+
+	// The rule is missing from ip6tables, so only iptables deletes it
+	r := &RecordingRunner{Paths: paths, Handler: func(cmd Cmd) (*Result, error) {
+		if cmd.Name == "ip6tables" && cmd.Args[0] == "-C" {
+			return &Result{ExitCode: 1}, nil
+		}
+		return nil, nil
+	}}
+	b := iptablesBackend{d: firewallDetector(r, nil), owner: "myapp"}
+	if err := b.remove(context.Background(), rule); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"iptables -C INPUT -p udp --dport 53 -m comment --comment myapp:allow:udp:53 -j ACCEPT",
+		"iptables -D INPUT -p udp --dport 53 -m comment --comment myapp:allow:udp:53 -j ACCEPT",
+		"ip6tables -C INPUT -p udp --dport 53 -m comment --comment myapp:allow:udp:53 -j ACCEPT",
+	}
+	if got := r.CommandLines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands =\n%q\nwant\n%q", got, want)
+	}
+
+	// Exit status 4 is a permission or lock error, not a missing rule
+	r = &RecordingRunner{Paths: paths, Handler: func(Cmd) (*Result, error) {
+		return &Result{ExitCode: 4, Stderr: []byte("Permission denied (you must be root)")}, nil
+	}}
+	b = iptablesBackend{d: firewallDetector(r, nil), owner: "myapp"}
+	var exitErr *ExitError
+	if err := b.remove(context.Background(), rule); !errors.As(err, &exitErr) || exitErr.ExitCode != 4 {
+		t.Errorf("remove() error = %v, want exit status 4", err)
+	}
+}
+
+func TestFirewallRemoveAllKeepsSSHRule(t *testing.T) {
+	ruleset := "-P INPUT ACCEPT\n" +
+		"-A INPUT -p tcp -m tcp --dport 22 -m comment --comment myapp:allow:tcp:22 -j ACCEPT\n" +
+		"-A INPUT -p udp -m udp --dport 53 -m comment --comment myapp:allow:udp:53 -j ACCEPT\n" +
+		"-A INPUT -p tcp -m tcp --dport 80 -m comment --comment other:allow:tcp:80 -j ACCEPT\n"
+	r := &RecordingRunner{
+		Paths: map[string]string{"iptables": "/usr/sbin/iptables"},
+		Handler: func(cmd Cmd) (*Result, error) {
+			if cmd.Args[0] == "-S" {
+				return &Result{Stdout: []byte(ruleset)}, nil
+			}
+			return nil, nil
+		},
+	}
+	env := map[string]string{"SSH_CONNECTION": "203.0.113.7 50122 192.0.2.10 22"}
+	fw, err := firewallDetector(r, env).Firewall(context.Background(), "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Reset()
+
+	var lockout *LockoutError
+	if err := fw.RemoveAll(context.Background()); !errors.As(err, &lockout) {
+		t.Fatalf("RemoveAll() error = %v, want *LockoutError", err)
+	}
+	want := []string{
+		"iptables -S INPUT",
+		"iptables -C INPUT -p udp --dport 53 -m comment --comment myapp:allow:udp:53 -j ACCEPT",
+		"iptables -D INPUT -p udp --dport 53 -m comment --comment myapp:allow:udp:53 -j ACCEPT",
+	}
+	if got := r.CommandLines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands =\n%q\nwant\n%q", got, want)
+	}
+
+	// Denying the session's port is refused before any command runs
+	r.Reset()
+	if err := fw.Deny(context.Background(), 22, TCP); !errors.As(err, &lockout) {
+		t.Errorf("Deny(22) error = %v, want *LockoutError", err)
+	}
+	if got := r.CommandLines(); len(got) != 0 {
+		t.Errorf("commands = %q, want none", got)
+	}
+}
+
+func TestCurrentSSHSession(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want SSHSession
+	}{
+		{
+			name: "SSH_CONNECTION",
+			env:  map[string]string{"SSH_CONNECTION": "203.0.113.7 50122 192.0.2.10 2222"},
+			want: SSHSession{
+				Client: netip.MustParseAddrPort("203.0.113.7:50122"),
+				Server: netip.MustParseAddrPort("192.0.2.10:2222"),
+				Source: "SSH_CONNECTION",
+			},
+		},
+		{
+			name: "SSH_CONNECTION over IPv6",
+			env:  map[string]string{"SSH_CONNECTION": "2001:db8::7 50122 2001:db8::10 22"},
+			want: SSHSession{
+				Client: netip.MustParseAddrPort("[2001:db8::7]:50122"),
+				Server: netip.MustParseAddrPort("[2001:db8::10]:22"),
+				Source: "SSH_CONNECTION",
+			},
+		},
+		{
+			name: "SSH_CLIENT",
+			env:  map[string]string{"SSH_CONNECTION": "garbage", "SSH_CLIENT": "::ffff:203.0.113.7 50122 22"},
+			want: SSHSession{
+				Client: netip.MustParseAddrPort("203.0.113.7:50122"),
+				Server: netip.AddrPortFrom(netip.Addr{}, 22),
+				Source: "SSH_CLIENT",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := firewallDetector(&RecordingRunner{}, tt.env).CurrentSSHSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*session, tt.want) {
+				t.Errorf("CurrentSSHSession() = %+v, want %+v", *session, tt.want)
+			}
+		})
+	}
+
+	// Not under sshd: the process chain ends at init
+	d := NewDetector(fstest.MapFS{
+		"proc/self/stat": {Data: []byte("4242 (bash) S 4200 4242 4242 34816 0")},
+		"proc/4200/stat": {Data: []byte("4200 (tmux: server) S 1 4200 4200 0 -1")},
+	})
+	d.Getenv = func(string) string { return "" }
+	if _, err := d.CurrentSSHSession(); !errors.Is(err, ErrNoSSHSession) {
+		t.Errorf("CurrentSSHSession() error = %v, want ErrNoSSHSession", err)
+	}
+}
+
+// deniedFS fails to open the paths in denied, as /proc/<pid>/fd of a
+// process owned by another user does.
+type deniedFS struct {
+	fs.FS
+	denied map[string]bool
+}
+
+func (f deniedFS) Open(name string) (fs.File, error) {
+	if f.denied[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return f.FS.Open(name)
+}
+
+func TestCurrentSSHSessionUnreadableSockets(t *testing.T) {
+	d := NewDetector(deniedFS{
+		FS: fstest.MapFS{
+			"proc/self/stat":      {Data: []byte("4242 (bash) S 4200 4242 4242 34816 0")},
+			"proc/4200/stat":      {Data: []byte("4200 (sshd-session) S 900 4200 4200 0 -1")},
+			"etc/ssh/sshd_config": {Data: []byte("Port 22\nPort 2222\n")},
+		},
+		denied: map[string]bool{"proc/4200/fd": true},
+	})
+	d.Runner = &RecordingRunner{Paths: map[string]string{"iptables": "/usr/sbin/iptables"},
+		Handler: iptablesHandler("iptables v1.8.9 (legacy)", defaultPolicies, nil)}
+	d.Getenv = func(string) string { return "" }
+
+	session, err := d.CurrentSSHSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Source != "sshd_config" || !reflect.DeepEqual(session.Ports, []int{22, 2222}) {
+		t.Errorf("CurrentSSHSession() = %+v, want every sshd port", session)
+	}
+
+	// Every configured port is protected
+	fw, err := d.Firewall(context.Background(), "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lockout *LockoutError
+	for _, port := range []int{22, 2222} {
+		if err := fw.Deny(context.Background(), port, TCP); !errors.As(err, &lockout) {
+			t.Errorf("Deny(%d/tcp) = %v, want *LockoutError", port, err)
+		}
+	}
+	if err := fw.Deny(context.Background(), 8080, TCP); err != nil {
+		t.Errorf("Deny(8080/tcp) = %v", err)
+	}
+	if err := session.CheckSSHPorts([]int{22}); !errors.As(err, &lockout) {
+		t.Errorf("CheckSSHPorts([22]) = %v, want *LockoutError", err)
+	}
+	if err := session.CheckSSHPorts([]int{22, 2222}); err != nil {
+		t.Errorf("CheckSSHPorts([22 2222]) = %v, want nil", err)
+	}
+}
+
+func TestSSHSessionChecks(t *testing.T) {
+	s := &SSHSession{Server: netip.MustParseAddrPort("192.0.2.10:22")}
+	var lockout *LockoutError
+
+	if err := s.CheckAddRule(PortRule{Port: 22, Protocol: TCP, Action: RuleDeny}); !errors.As(err, &lockout) {
+		t.Errorf("CheckAddRule(deny 22/tcp) = %v, want *LockoutError", err)
+	}
+	if err := s.CheckAddRule(PortRule{Port: 22, Protocol: UDP, Action: RuleDeny}); err != nil {
+		t.Errorf("CheckAddRule(deny 22/udp) = %v, want nil", err)
+	}
+	if err := s.CheckRemoveRule(PortRule{Port: 22, Protocol: TCP, Action: RuleAllow}); !errors.As(err, &lockout) {
+		t.Errorf("CheckRemoveRule(allow 22/tcp) = %v, want *LockoutError", err)
+	}
+	if err := s.CheckSSHPorts([]int{2222}); !errors.As(err, &lockout) {
+		t.Errorf("CheckSSHPorts([2222]) = %v, want *LockoutError", err)
+	}
+	if err := s.CheckSSHPorts([]int{22, 2222}); err != nil {
+		t.Errorf("CheckSSHPorts([22 2222]) = %v, want nil", err)
+	}
+
+	var none *SSHSession
+	if err := none.CheckAddRule(PortRule{Port: 22, Protocol: TCP, Action: RuleDeny}); err != nil {
+		t.Errorf("nil session refused a change: %v", err)
+	}
+}
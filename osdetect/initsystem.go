@@ -0,0 +1,112 @@
+package osdetect
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// InitSystem identifies the init system running as PID 1.
+type InitSystem string
+
+const (
+	InitSystemd InitSystem = "systemd"
+	InitOpenRC  InitSystem = "openrc"
+	InitRunit   InitSystem = "runit"
+	InitSysV    InitSystem = "sysvinit"
+	InitNone    InitSystem = "none" // Container whose PID 1 is the application itself
+	InitUnknown InitSystem = "unknown"
+)
+
+// DetectInitSystem detects the host's init system.
+func DetectInitSystem() InitSystem {
+	return defaultDetector.DetectInitSystem()
+}
+
+// DetectInitSystem detects the init system from /run and /proc/1.
+func (d *Detector) DetectInitSystem() InitSystem {
+	// sd_booted(3): systemd creates this directory when it is PID 1
+	if d.isDir("/run/systemd/system") {
+		return InitSystemd
+	}
+
+	comm := d.pid1Comm()
+	switch comm {
+	case "systemd":
+		return InitSystemd
+	case "openrc-init":
+		return InitOpenRC
+	case "runit", "runit-init":
+		return InitRunit
+	}
+
+	// OpenRC commonly runs on top of sysvinit or busybox init
+	if d.exists("/run/openrc/softlevel") {
+		return InitOpenRC
+	}
+	if comm == "init" && d.exists("/etc/inittab") {
+		return InitSysV
+	}
+	if d.InContainer() {
+		return InitNone
+	}
+	return InitUnknown
+}
+
+// pid1Comm returns the command name of PID 1.
+func (d *Detector) pid1Comm() string {
+	return d.processComm("1")
+}
+
+// processComm returns the command name of process pid, or "" if unknown.
+func (d *Detector) processComm(pid string) string {
+	data, err := d.readFile(path.Join("/proc", pid, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// InContainer reports whether the host is running inside a container.
+func InContainer() bool {
+	return defaultDetector.InContainer()
+}
+
+// InContainer reports whether the system is a container, based on the
+// marker files and environment left by common container runtimes.
+func (d *Detector) InContainer() bool {
+	if d.exists("/.dockerenv") || d.exists("/run/.containerenv") {
+		return true
+	}
+
+	// systemd and most runtimes set container= in PID 1's environment
+	if environ, err := d.readFile("/proc/1/environ"); err == nil {
+		for _, env := range bytes.Split(environ, []byte{0}) {
+			if bytes.HasPrefix(env, []byte("container=")) {
+				return true
+			}
+		}
+	}
+
+	if cgroup, err := d.readFile("/proc/1/cgroup"); err == nil {
+		for _, marker := range []string{"docker", "kubepods", "containerd", "lxc", "libpod"} {
+			if strings.Contains(string(cgroup), marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exists reports whether name exists in the detector's filesystem.
+func (d *Detector) exists(name string) bool {
+	_, err := fs.Stat(d.FS, fsPath(name))
+	return err == nil
+}
+
+// isDir reports whether name is a directory in the detector's filesystem.
+func (d *Detector) isDir(name string) bool {
+	info, err := fs.Stat(d.FS, fsPath(name))
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,374 @@
+package osdetect
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AddrScope is the reach of an interface address.
+type AddrScope string
+
+const (
+	ScopeHost   AddrScope = "host"   // Loopback, e.g., 127.0.0.1, ::1
+	ScopeLink   AddrScope = "link"   // Link-local, e.g., 169.254.0.0/16, fe80::/10
+	ScopeGlobal AddrScope = "global" // Routable beyond the link, including private ranges
+)
+
+// InterfaceAddr is an address assigned to an interface.
+type InterfaceAddr struct {
+	Prefix netip.Prefix // Address with its prefix length, e.g., 192.168.1.10/24
+	Scope  AddrScope
+	Class  AddrClass
+}
+
+// Addr returns the address without its prefix length.
+func (a InterfaceAddr) Addr() netip.Addr {
+	return a.Prefix.Addr()
+}
+
+// Is6 reports whether the address is IPv6.
+func (a InterfaceAddr) Is6() bool {
+	return a.Prefix.Addr().Is6()
+}
+
+func (a InterfaceAddr) String() string {
+	return a.Prefix.String()
+}
+
+// Interface describes a network interface and its addresses.
+type Interface struct {
+	Index     int
+	Name      string // e.g., "eth0"
+	MTU       int
+	Flags     net.Flags
+	MAC       net.HardwareAddr // Empty for interfaces without one, e.g., loopback, tun
+	OperState string           // From /sys/class/net, e.g., "up", "down", "unknown"
+	Addrs     []InterfaceAddr
+	Default   bool // Interface carries the IPv4 or IPv6 default route
+}
+
+// IsUp reports whether the interface is administratively up.
+func (i *Interface) IsUp() bool {
+	return i.Flags&net.FlagUp != 0
+}
+
+// IsLoopback reports whether the interface is a loopback interface.
+func (i *Interface) IsLoopback() bool {
+	return i.Flags&net.FlagLoopback != 0
+}
+
+// IPv4 returns the interface's IPv4 addresses.
+func (i *Interface) IPv4() []InterfaceAddr {
+	var addrs []InterfaceAddr
+	for _, a := range i.Addrs {
+		if !a.Is6() {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// IPv6 returns the interface's IPv6 addresses.
+func (i *Interface) IPv6() []InterfaceAddr {
+	var addrs []InterfaceAddr
+	for _, a := range i.Addrs {
+		if a.Is6() {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// Interfaces returns every network interface on the host, ordered by index.
+func Interfaces() ([]Interface, error) {
+	return defaultDetector.Interfaces()
+}
+
+// Interfaces returns every network interface, ordered by index. On the
+// host, links and addresses come from the running kernel. For another
+// root, such as a mounted container filesystem with its own /sys and
+// /proc, they are read from the root's files instead; see sysInterfaces.
+// Operational state and default routes are always read from the
+// detector's /sys and /proc.
+func (d *Detector) Interfaces() ([]Interface, error) {
+	var result []Interface
+	var err error
+	if d.Root == "/" {
+		result, err = hostInterfaces()
+	} else {
+		result, err = d.sysInterfaces()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defaultIfaces := make(map[string]bool)
+	for _, family := range []AddrFamily{IPv4, IPv6} {
+		if route, err := d.DefaultRoute(family); err == nil {
+			defaultIfaces[route.Interface] = true
+		}
+	}
+	for i := range result {
+		result[i].OperState = d.operState(result[i].Name)
+		result[i].Default = defaultIfaces[result[i].Name]
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Index < result[j].Index })
+	return result, nil
+}
+
+// hostInterfaces lists the running kernel's links and addresses.
+func hostInterfaces() ([]Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Interface
+	for _, iface := range ifaces {
+		info := Interface{
+			Index: iface.Index,
+			Name:  iface.Name,
+			MTU:   iface.MTU,
+			Flags: iface.Flags,
+			MAC:   iface.HardwareAddr,
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, ok := netip.AddrFromSlice(ipnet.IP)
+			if !ok {
+				continue
+			}
+			ones, _ := ipnet.Mask.Size()
+			info.Addrs = append(info.Addrs, newInterfaceAddr(netip.PrefixFrom(ip.Unmap(), ones)))
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// Interface flags from linux/if.h, as in /sys/class/net/<name>/flags.
+const (
+	iffUp           = 0x1
+	iffBroadcast    = 0x2
+	iffLoopback     = 0x8
+	iffPointToPoint = 0x10
+	iffRunning      = 0x40
+	iffMulticast    = 0x1000
+)
+
+// sysInterfaces lists links from /sys/class/net, IPv6 addresses from
+// /proc/net/if_inet6 and IPv4 addresses from /proc/net/fib_trie. The trie
+// does not name interfaces, so each IPv4 address is assigned to the
+// interface of the most specific connected route containing it; addresses
+// without one, other than loopback, are omitted.
+func (d *Detector) sysInterfaces() ([]Interface, error) {
+	entries, err := fs.ReadDir(d.FS, fsPath("/sys/class/net"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+
+	var result []Interface
+	byName := make(map[string]*Interface)
+	var loopback string
+	for _, entry := range entries {
+		dir := path.Join("/sys/class/net", entry.Name())
+		index, err := strconv.Atoi(d.sysValue(dir, "ifindex"))
+		if err != nil {
+			continue // Not a link, e.g., bonding_masters
+		}
+		mtu, _ := strconv.Atoi(d.sysValue(dir, "mtu"))
+		raw, _ := strconv.ParseUint(d.sysValue(dir, "flags"), 0, 32)
+		iface := Interface{Index: index, Name: entry.Name(), MTU: mtu, Flags: linkFlags(raw)}
+		// Like net.Interfaces, leave out the all-zero address of loopback
+		mac, err := net.ParseMAC(d.sysValue(dir, "address"))
+		if err == nil && slices.ContainsFunc(mac, func(b byte) bool { return b != 0 }) {
+			iface.MAC = mac
+		}
+		if iface.IsLoopback() {
+			loopback = iface.Name
+		}
+		result = append(result, iface)
+	}
+	for i := range result {
+		byName[result[i].Name] = &result[i]
+	}
+
+	v4, err := d.ipv4Addrs(loopback)
+	if err != nil {
+		return nil, err
+	}
+	v6, err := d.ipv6Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addrs := range []map[string][]netip.Prefix{v4, v6} {
+		for name, prefixes := range addrs {
+			iface, ok := byName[name]
+			if !ok {
+				continue
+			}
+			for _, prefix := range prefixes {
+				iface.Addrs = append(iface.Addrs, newInterfaceAddr(prefix))
+			}
+		}
+	}
+	return result, nil
+}
+
+// sysValue returns the trimmed contents of the attribute file name in dir.
+func (d *Detector) sysValue(dir, name string) string {
+	data, err := d.readFile(path.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// linkFlags converts kernel interface flags to net.Flags.
+func linkFlags(raw uint64) net.Flags {
+	var flags net.Flags
+	for _, f := range []struct {
+		raw  uint64
+		flag net.Flags
+	}{
+		{iffUp, net.FlagUp},
+		{iffBroadcast, net.FlagBroadcast},
+		{iffLoopback, net.FlagLoopback},
+		{iffPointToPoint, net.FlagPointToPoint},
+		{iffRunning, net.FlagRunning},
+		{iffMulticast, net.FlagMulticast},
+	} {
+		if raw&f.raw != 0 {
+			flags |= f.flag
+		}
+	}
+	return flags
+}
+
+// ipv4Addrs returns the local IPv4 addresses in /proc/net/fib_trie by
+// interface. Leaves look like:
+//
+//	|-- 192.168.1.10
+//	   /32 host LOCAL
+func (d *Detector) ipv4Addrs(loopback string) (map[string][]netip.Prefix, error) {
+	file, err := d.open("/proc/net/fib_trie")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// The trie is printed once per routing table, so addresses repeat
+	var locals []netip.Addr
+	seen := make(map[netip.Addr]bool)
+	var leaf netip.Addr
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 2 && fields[0] == "|--":
+			leaf, _ = netip.ParseAddr(fields[1])
+		case len(fields) == 3 && fields[0] == "/32" && fields[2] == "LOCAL" && leaf.IsValid() && !seen[leaf]:
+			seen[leaf] = true
+			locals = append(locals, leaf)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	routes, err := d.ipv4Routes()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	addrs := make(map[string][]netip.Prefix)
+	for _, ip := range locals {
+		var best *Route
+		for i, r := range routes {
+			if !r.Gateway.IsValid() && r.Destination.Contains(ip) && (best == nil || r.Destination.Bits() > best.Destination.Bits()) {
+				best = &routes[i]
+			}
+		}
+		switch {
+		case best != nil:
+			addrs[best.Interface] = append(addrs[best.Interface], netip.PrefixFrom(ip, best.Destination.Bits()))
+		case ip.IsLoopback() && loopback != "":
+			addrs[loopback] = append(addrs[loopback], netip.PrefixFrom(ip, 8))
+		}
+	}
+	return addrs, nil
+}
+
+// ipv6Addrs returns the addresses in /proc/net/if_inet6 by interface:
+// address ifindex prefix_len scope flags name
+func (d *Detector) ipv6Addrs() (map[string][]netip.Prefix, error) {
+	file, err := d.open("/proc/net/if_inet6")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil // IPv6 is disabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	addrs := make(map[string][]netip.Prefix)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		ip, err1 := parseIPv6Hex(fields[0])
+		plen, err2 := strconv.ParseUint(fields[2], 16, 8)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		addrs[fields[5]] = append(addrs[fields[5]], netip.PrefixFrom(ip, int(plen)))
+	}
+	return addrs, scanner.Err()
+}
+
+// newInterfaceAddr classifies the address of prefix.
+func newInterfaceAddr(prefix netip.Prefix) InterfaceAddr {
+	return InterfaceAddr{Prefix: prefix, Scope: addrScope(prefix.Addr()), Class: ClassifyAddr(prefix.Addr())}
+}
+
+// operState returns the operational state of interface name, or "unknown".
+func (d *Detector) operState(name string) string {
+	data, err := d.readFile(path.Join("/sys/class/net", name, "operstate"))
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// addrScope classifies ip as host, link or global scope.
+func addrScope(ip netip.Addr) AddrScope {
+	switch {
+	case ip.IsLoopback():
+		return ScopeHost
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return ScopeLink
+	}
+	return ScopeGlobal
+}
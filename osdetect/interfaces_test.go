@@ -0,0 +1,104 @@
+package osdetect
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// procNetFibTrie is the trie for lo and eth0 at 192.0.2.10/24; the kernel
+// prints it again for the local table.
+const procNetFibTrie = `Main:
+  +-- 0.0.0.0/0 3 0 5
+     |-- 0.0.0.0
+        /0 universe UNICAST
+     +-- 127.0.0.0/8 2 0 2
+        +-- 127.0.0.0/31 1 0 0
+           |-- 127.0.0.0
+              /8 host LOCAL
+           |-- 127.0.0.1
+              /32 host LOCAL
+        |-- 127.255.255.255
+           /32 link BROADCAST
+     +-- 192.0.2.0/24 2 0 2
+        +-- 192.0.2.0/28 2 0 2
+           |-- 192.0.2.0
+              /24 link UNICAST
+           |-- 192.0.2.10
+              /32 host LOCAL
+        |-- 192.0.2.255
+           /32 link BROADCAST
+Local:
+  +-- 0.0.0.0/0 3 0 5
+     +-- 127.0.0.0/8 2 0 2
+        +-- 127.0.0.0/31 1 0 0
+           |-- 127.0.0.1
+              /32 host LOCAL
+     +-- 192.0.2.0/24 2 0 2
+           |-- 192.0.2.10
+              /32 host LOCAL
+`
+
+// procNetIfInet6 is in network byte order on every architecture.
+const procNetIfInet6 = "" +
+	"00000000000000000000000000000001 01 80 10 80       lo\n" +
+	"20010db8000000000000000000000010 02 40 00 00     eth0\n" +
+	"fe80000000000000505400fffe123456 02 40 20 80     eth0\n"
+
+// sysClassNet returns /sys/class/net files for a link.
+func sysClassNet(files fstest.MapFS, name, index, flags, mtu, address, operstate string) {
+	dir := "sys/class/net/" + name + "/"
+	files[dir+"ifindex"] = &fstest.MapFile{Data: []byte(index + "\n")}
+	files[dir+"flags"] = &fstest.MapFile{Data: []byte(flags + "\n")}
+	files[dir+"mtu"] = &fstest.MapFile{Data: []byte(mtu + "\n")}
+	files[dir+"address"] = &fstest.MapFile{Data: []byte(address + "\n")}
+	files[dir+"operstate"] = &fstest.MapFile{Data: []byte(operstate + "\n")}
+}
+
+func TestInterfacesFromFiles(t *testing.T) {
+	skipUnlessLittleEndian(t)
+
+	files := fstest.MapFS{
+		"proc/net/fib_trie": {Data: []byte(procNetFibTrie)},
+		"proc/net/if_inet6": {Data: []byte(procNetIfInet6)},
+		"proc/net/route": {Data: []byte("Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+			"eth0\t00000000\t010200C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+			"eth0\t000200C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n")},
+		"sys/class/net/bonding_masters": {Data: []byte("\n")},
+	}
+	sysClassNet(files, "lo", "1", "0x9", "65536", "00:00:00:00:00:00", "unknown")
+	sysClassNet(files, "eth0", "2", "0x1003", "1500", "52:54:00:12:34:56", "up")
+	sysClassNet(files, "eth1", "3", "0x1002", "1500", "52:54:00:65:43:21", "down")
+
+	got, err := NewDetector(files).Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := func(s string) InterfaceAddr { return newInterfaceAddr(netip.MustParsePrefix(s)) }
+	want := []Interface{
+		{
+			Index: 1, Name: "lo", MTU: 65536, Flags: net.FlagUp | net.FlagLoopback, OperState: "unknown",
+			Addrs: []InterfaceAddr{addr("127.0.0.1/8"), addr("::1/128")},
+		},
+		{
+			Index: 2, Name: "eth0", MTU: 1500, Flags: net.FlagUp | net.FlagBroadcast | net.FlagMulticast,
+			MAC: net.HardwareAddr{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}, OperState: "up", Default: true,
+			Addrs: []InterfaceAddr{addr("192.0.2.10/24"), addr("2001:db8::10/64"), addr("fe80::5054:ff:fe12:3456/64")},
+		},
+		{
+			Index: 3, Name: "eth1", MTU: 1500, Flags: net.FlagBroadcast | net.FlagMulticast,
+			MAC: net.HardwareAddr{0x52, 0x54, 0x00, 0x65, 0x43, 0x21}, OperState: "down",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Interfaces() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestInterfacesMissingSysfs(t *testing.T) {
+	if _, err := NewDetector(fstest.MapFS{}).Interfaces(); err == nil {
+		t.Error("Interfaces() succeeded without /sys/class/net")
+	}
+}
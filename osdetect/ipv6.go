@@ -0,0 +1,82 @@
+package osdetect
+
+import (
+	"errors"
+	"net/netip"
+	"path"
+	"strings"
+)
+
+// IPv6Status reports how usable IPv6 is on the host.
+type IPv6Status struct {
+	Disabled   bool     // IPv6 is missing from the kernel or net.ipv6.conf.all.disable_ipv6=1
+	DisabledOn []string // Interfaces with net.ipv6.conf.<iface>.disable_ipv6=1
+
+	// Addresses on non-loopback interfaces that are up, by kind
+	LinkLocal []netip.Addr // fe80::/10, present on almost every interface
+	ULA       []netip.Addr // fc00::/7, routable only within a site
+	Global    []netip.Addr // Public unicast, excluding documentation and reserved ranges
+
+	DefaultRoute *Route // nil if there is no IPv6 default route
+}
+
+// HasGlobal reports whether the host can reach and be reached over the
+// IPv6 internet: it has a global address and an IPv6 default route.
+func (s *IPv6Status) HasGlobal() bool {
+	return !s.Disabled && len(s.Global) > 0 && s.DefaultRoute != nil
+}
+
+// DetectIPv6 inspects the host's IPv6 addresses, sysctls and default route.
+func DetectIPv6() (*IPv6Status, error) {
+	return defaultDetector.DetectIPv6()
+}
+
+// DetectIPv6 inspects the IPv6 addresses of interfaces that are up, the
+// disable_ipv6 sysctls and the IPv6 default route.
+func (d *Detector) DetectIPv6() (*IPv6Status, error) {
+	status := &IPv6Status{}
+
+	if !d.exists("/proc/sys/net/ipv6") || d.sysctlBool("/proc/sys/net/ipv6/conf/all/disable_ipv6") {
+		status.Disabled = true
+		return status, nil
+	}
+
+	ifaces, err := d.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if d.sysctlBool(path.Join("/proc/sys/net/ipv6/conf", iface.Name, "disable_ipv6")) {
+			status.DisabledOn = append(status.DisabledOn, iface.Name)
+			continue
+		}
+		// Addresses on a link that is down cannot be used; loopback and
+		// tunnel devices report "unknown"
+		if iface.IsLoopback() || !iface.IsUp() || (iface.OperState != "up" && iface.OperState != "unknown") {
+			continue
+		}
+		for _, a := range iface.IPv6() {
+			switch a.Class {
+			case AddrLinkLocal:
+				status.LinkLocal = append(status.LinkLocal, a.Addr())
+			case AddrULA:
+				status.ULA = append(status.ULA, a.Addr())
+			case AddrPublic:
+				status.Global = append(status.Global, a.Addr())
+			}
+		}
+	}
+
+	route, err := d.DefaultRoute(IPv6)
+	if err != nil && !errors.Is(err, ErrNoDefaultRoute) {
+		return nil, err
+	}
+	status.DefaultRoute = route
+	return status, nil
+}
+
+// sysctlBool reports whether the sysctl file name contains "1".
+func (d *Detector) sysctlBool(name string) bool {
+	data, err := d.readFile(name)
+	return err == nil && strings.TrimSpace(string(data)) == "1"
+}
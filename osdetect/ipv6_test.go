@@ -0,0 +1,93 @@
+package osdetect
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDetectIPv6(t *testing.T) {
+	tests := []struct {
+		name  string
+		inet6 string
+		route string
+		links func(fstest.MapFS)
+		want  IPv6Status
+	}{
+		{
+			// eth1 is down, so its global address is unusable
+			name: "down link",
+			inet6: "00000000000000000000000000000001 01 80 10 80       lo\n" +
+				"fe80000000000000505400fffe123456 02 40 20 80     eth0\n" +
+				"20010db8000000000000000000000020 03 40 00 00     eth1\n",
+			route: "00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eth1\n",
+			links: func(files fstest.MapFS) {
+				sysClassNet(files, "lo", "1", "0x9", "65536", "00:00:00:00:00:00", "unknown")
+				sysClassNet(files, "eth0", "2", "0x1003", "1500", "52:54:00:12:34:56", "up")
+				sysClassNet(files, "eth1", "3", "0x1002", "1500", "52:54:00:65:43:21", "down")
+			},
+			want: IPv6Status{
+				LinkLocal: []netip.Addr{netip.MustParseAddr("fe80::5054:ff:fe12:3456")},
+				DefaultRoute: &Route{Family: IPv6, Destination: netip.MustParsePrefix("::/0"),
+					Gateway: netip.MustParseAddr("fe80::1"), Metric: 1024, Interface: "eth1"},
+			},
+		},
+		{
+			// Admin up, but without carrier
+			name:  "no carrier",
+			inet6: "20010db8000000000000000000000020 02 40 00 00     eth0\n",
+			links: func(files fstest.MapFS) {
+				sysClassNet(files, "eth0", "2", "0x1003", "1500", "52:54:00:12:34:56", "down")
+			},
+		},
+		{
+			name: "ULA only",
+			inet6: "fd12345678900001000000000000000a 02 40 00 00     eth0\n" +
+				"fe80000000000000505400fffe123456 02 40 20 80     eth0\n" +
+				"fd0000000000000000000000000000aa 03 80 00 00      wg0\n",
+			links: func(files fstest.MapFS) {
+				sysClassNet(files, "eth0", "2", "0x1003", "1500", "52:54:00:12:34:56", "up")
+				sysClassNet(files, "wg0", "3", "0x91", "1420", "", "unknown")
+			},
+			want: IPv6Status{
+				LinkLocal: []netip.Addr{netip.MustParseAddr("fe80::5054:ff:fe12:3456")},
+				ULA:       []netip.Addr{netip.MustParseAddr("fd12:3456:7890:1::a"), netip.MustParseAddr("fd00::aa")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := fstest.MapFS{
+				"proc/sys/net/ipv6/conf/all/disable_ipv6": {Data: []byte("0\n")},
+				"proc/net/if_inet6":                       {Data: []byte(tt.inet6)},
+				"proc/net/ipv6_route":                     {Data: []byte(tt.route)},
+			}
+			tt.links(files)
+
+			got, err := NewDetector(files).DetectIPv6()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("DetectIPv6() =\n%+v\nwant\n%+v", *got, tt.want)
+			}
+			if got.HasGlobal() {
+				t.Error("HasGlobal() = true without a usable global address")
+			}
+		})
+	}
+}
+
+func TestDetectIPv6Disabled(t *testing.T) {
+	d := NewDetector(fstest.MapFS{
+		"proc/sys/net/ipv6/conf/all/disable_ipv6": {Data: []byte("1\n")},
+	})
+	got, err := d.DetectIPv6()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Disabled {
+		t.Errorf("DetectIPv6() = %+v, want Disabled", got)
+	}
+}
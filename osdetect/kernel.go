@@ -0,0 +1,223 @@
+package osdetect
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// KernelVersion is a parsed kernel release.
+type KernelVersion struct {
+	Major, Minor, Patch int
+	Release             string // Full release as printed by `uname -r`, e.g., "6.8.0-45-generic"
+}
+
+// ParseKernelVersion parses a kernel release such as "6.8.0-45-generic" or "5.15.153.1-microsoft-standard-WSL2".
+func ParseKernelVersion(release string) (KernelVersion, error) {
+	v := KernelVersion{Release: release}
+
+	// The numeric prefix ends at the first character that is not a digit or '.'
+	numeric := release
+	if i := strings.IndexFunc(release, func(r rune) bool { return (r < '0' || r > '9') && r != '.' }); i >= 0 {
+		numeric = release[:i]
+	}
+	parts := strings.Split(numeric, ".")
+	if len(parts) < 2 {
+		return v, fmt.Errorf("invalid kernel release '%s'", release)
+	}
+
+	var err error
+	if v.Major, err = strconv.Atoi(parts[0]); err != nil {
+		return v, fmt.Errorf("invalid kernel release '%s'", release)
+	}
+	if v.Minor, err = strconv.Atoi(parts[1]); err != nil {
+		return v, fmt.Errorf("invalid kernel release '%s'", release)
+	}
+	if len(parts) > 2 {
+		v.Patch, _ = strconv.Atoi(parts[2])
+	}
+	return v, nil
+}
+
+// AtLeast reports whether the version is major.minor or newer.
+func (v KernelVersion) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+func (v KernelVersion) String() string {
+	return v.Release
+}
+
+// ModuleStatus is the state of a kernel module.
+type ModuleStatus string
+
+const (
+	ModuleLoaded    ModuleStatus = "loaded"
+	ModuleBuiltin   ModuleStatus = "builtin"   // Compiled into the kernel, always available
+	ModuleAvailable ModuleStatus = "available" // Listed in modules.dep, loadable with modprobe
+	ModuleMissing   ModuleStatus = "missing"
+)
+
+// Usable reports whether the module's functionality is present or can be loaded.
+func (s ModuleStatus) Usable() bool {
+	return s != ModuleMissing
+}
+
+// KernelInfo describes the running kernel's networking capabilities.
+type KernelInfo struct {
+	Version     KernelVersion
+	ProcVersion string // Contents of /proc/version, including the compiler and build date
+
+	TUN bool // /dev/net/tun exists
+
+	CongestionControl  string   // Current TCP congestion control, e.g., "cubic"
+	CongestionControls []string // Available TCP congestion controls, e.g., ["reno", "cubic", "bbr"]
+}
+
+// HasCongestionControl reports whether name is an available TCP congestion control.
+func (k *KernelInfo) HasCongestionControl(name string) bool {
+	for _, cc := range k.CongestionControls {
+		if cc == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectKernel inspects the host's kernel.
+func DetectKernel() (*KernelInfo, error) {
+	return defaultDetector.DetectKernel()
+}
+
+// DetectKernel reads the kernel release, /proc/version, TUN support and TCP
+// congestion controls. Congestion controls built as modules, such as
+// tcp_bbr, are only listed once loaded; see KernelModuleStatus.
+func (d *Detector) DetectKernel() (*KernelInfo, error) {
+	release, err := d.kernelRelease()
+	if err != nil {
+		return nil, err
+	}
+	version, err := ParseKernelVersion(release)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &KernelInfo{Version: version, TUN: d.HasTUN()}
+	if data, err := d.readFile("/proc/version"); err == nil {
+		info.ProcVersion = strings.TrimSpace(string(data))
+	}
+	if data, err := d.readFile("/proc/sys/net/ipv4/tcp_congestion_control"); err == nil {
+		info.CongestionControl = strings.TrimSpace(string(data))
+	}
+	if data, err := d.readFile("/proc/sys/net/ipv4/tcp_available_congestion_control"); err == nil {
+		info.CongestionControls = strings.Fields(string(data))
+	}
+	return info, nil
+}
+
+// kernelRelease returns the kernel release from /proc, falling back to uname(2).
+func (d *Detector) kernelRelease() (string, error) {
+	if data, err := d.readFile("/proc/sys/kernel/osrelease"); err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	_, release, err := d.uname()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine kernel release: %w", err)
+	}
+	return release, nil
+}
+
+// HasTUN reports whether the host has the /dev/net/tun device.
+func HasTUN() bool {
+	return defaultDetector.HasTUN()
+}
+
+// HasTUN reports whether /dev/net/tun exists as a character device.
+func (d *Detector) HasTUN() bool {
+	info, err := fs.Stat(d.FS, fsPath("/dev/net/tun"))
+	return err == nil && info.Mode()&fs.ModeCharDevice != 0
+}
+
+// KernelModuleStatus reports whether a module on the host is loaded, built in, loadable or missing.
+func KernelModuleStatus(name string) ModuleStatus {
+	return defaultDetector.KernelModuleStatus(name)
+}
+
+// KernelModuleStatus reports the state of module name, e.g., "tun",
+// "wireguard" or "tcp_bbr", from /proc/modules, /sys/module and the
+// running kernel's modules.builtin and modules.dep.
+func (d *Detector) KernelModuleStatus(name string) ModuleStatus {
+	name = moduleName(name)
+
+	if file, err := d.open("/proc/modules"); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) > 0 && fields[0] == name {
+				return ModuleLoaded
+			}
+		}
+	}
+
+	// Built-in modules with parameters appear in /sys/module but not in /proc/modules
+	if d.isDir(path.Join("/sys/module", name)) {
+		return ModuleBuiltin
+	}
+
+	dir := d.modulesDir()
+	if dir == "" {
+		return ModuleMissing
+	}
+	if d.moduleListed(path.Join(dir, "modules.builtin"), name) {
+		return ModuleBuiltin
+	}
+	if d.moduleListed(path.Join(dir, "modules.dep"), name) {
+		return ModuleAvailable
+	}
+	return ModuleMissing
+}
+
+// modulesDir returns the running kernel's module directory, or "" if it is missing.
+func (d *Detector) modulesDir() string {
+	release, err := d.kernelRelease()
+	if err != nil {
+		return ""
+	}
+	for _, base := range []string{"/lib/modules", "/usr/lib/modules"} {
+		if dir := path.Join(base, release); d.isDir(dir) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// moduleListed reports whether name appears in a module list such as
+// modules.dep, whose lines look like "kernel/net/ipv4/tcp_bbr.ko.zst: deps".
+func (d *Detector) moduleListed(list, name string) bool {
+	file, err := d.open(list)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		modPath, _, _ := strings.Cut(scanner.Text(), ":")
+		if moduleName(path.Base(strings.TrimSpace(modPath))) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleName normalizes a module or file name, e.g., "nf-conntrack.ko.xz"
+// to "nf_conntrack", since the kernel treats '-' and '_' alike.
+func moduleName(name string) string {
+	if i := strings.Index(name, ".ko"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
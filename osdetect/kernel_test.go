@@ -0,0 +1,116 @@
+package osdetect
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseKernelVersion(t *testing.T) {
+	tests := []struct {
+		release             string
+		major, minor, patch int
+	}{
+		{"5.15.0-91-generic", 5, 15, 0},
+		{"6.8.0-1.fc40.x86_64", 6, 8, 0},
+		{"4.19.0+", 4, 19, 0},
+		{"6.1.0-18-amd64", 6, 1, 0},
+		{"5.15.153.1-microsoft-standard-WSL2", 5, 15, 153},
+		{"6.6", 6, 6, 0},
+	}
+	for _, tt := range tests {
+		v, err := ParseKernelVersion(tt.release)
+		if err != nil {
+			t.Errorf("ParseKernelVersion(%q): %v", tt.release, err)
+			continue
+		}
+		if v.Major != tt.major || v.Minor != tt.minor || v.Patch != tt.patch || v.String() != tt.release {
+			t.Errorf("ParseKernelVersion(%q) = %+v, want %d.%d.%d", tt.release, v, tt.major, tt.minor, tt.patch)
+		}
+	}
+
+	for _, release := range []string{"", "6", "linux-6.8", "6.x"} {
+		if _, err := ParseKernelVersion(release); err == nil {
+			t.Errorf("ParseKernelVersion(%q) succeeded", release)
+		}
+	}
+}
+
+func TestKernelVersionAtLeast(t *testing.T) {
+	v := KernelVersion{Major: 5, Minor: 15}
+	for _, tt := range []struct {
+		major, minor int
+		want         bool
+	}{
+		{4, 19, true},
+		{5, 6, true},
+		{5, 15, true},
+		{5, 16, false},
+		{6, 0, false},
+	} {
+		if got := v.AtLeast(tt.major, tt.minor); got != tt.want {
+			t.Errorf("5.15 AtLeast(%d, %d) = %v, want %v", tt.major, tt.minor, got, tt.want)
+		}
+	}
+}
+
+func TestKernelModuleStatus(t *testing.T) {
+	d := NewDetector(fstest.MapFS{
+		"proc/sys/kernel/osrelease": {Data: []byte("6.8.0-45-generic\n")},
+		"proc/modules": {Data: []byte("wireguard 118784 0 - Live 0x0000000000000000\n" +
+			"nf_conntrack 196608 1 wireguard, Live 0x0000000000000000\n")},
+		"sys/module/tun": {Mode: fs.ModeDir},
+		"lib/modules/6.8.0-45-generic/modules.builtin": {Data: []byte("kernel/drivers/net/tun.ko\n" +
+			"kernel/net/ipv4/tcp_cubic.ko\n")},
+		"lib/modules/6.8.0-45-generic/modules.dep": {Data: []byte("kernel/net/ipv4/tcp_bbr.ko.zst:\n" +
+			"kernel/drivers/net/wireguard/wireguard.ko.zst: kernel/lib/crypto/libchacha20poly1305.ko.zst\n")},
+	})
+
+	tests := []struct {
+		name string
+		want ModuleStatus
+	}{
+		{"wireguard", ModuleLoaded},
+		{"nf-conntrack", ModuleLoaded},
+		{"tun", ModuleBuiltin},       // In /sys/module
+		{"tcp_cubic", ModuleBuiltin}, // Only in modules.builtin
+		{"tcp_bbr", ModuleAvailable},
+		{"sch_cake", ModuleMissing},
+	}
+	for _, tt := range tests {
+		if got := d.KernelModuleStatus(tt.name); got != tt.want {
+			t.Errorf("KernelModuleStatus(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if ModuleMissing.Usable() || !ModuleAvailable.Usable() {
+		t.Error("Usable() is wrong")
+	}
+
+	// Without the running kernel's module directory, only loaded modules are known
+	d = NewDetector(fstest.MapFS{"proc/sys/kernel/osrelease": {Data: []byte("6.9.1-arch1-1\n")}})
+	if got := d.KernelModuleStatus("tcp_bbr"); got != ModuleMissing {
+		t.Errorf("KernelModuleStatus(tcp_bbr) = %q, want missing", got)
+	}
+}
+
+func TestDetectKernel(t *testing.T) {
+	d := NewDetector(fstest.MapFS{
+		"proc/sys/kernel/osrelease":                          {Data: []byte("6.8.0-45-generic\n")},
+		"proc/version":                                       {Data: []byte("Linux version 6.8.0-45-generic (buildd@lcy02-amd64-075) #45-Ubuntu SMP\n")},
+		"proc/sys/net/ipv4/tcp_congestion_control":           {Data: []byte("cubic\n")},
+		"proc/sys/net/ipv4/tcp_available_congestion_control": {Data: []byte("reno cubic bbr\n")},
+		"dev/net/tun":                                        {Mode: fs.ModeDevice | fs.ModeCharDevice},
+	})
+
+	info, err := d.DetectKernel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Version.AtLeast(6, 8) || !info.TUN || info.CongestionControl != "cubic" {
+		t.Errorf("DetectKernel() = %+v", info)
+	}
+	if !reflect.DeepEqual(info.CongestionControls, []string{"reno", "cubic", "bbr"}) || !info.HasCongestionControl("bbr") {
+		t.Errorf("CongestionControls = %q, want reno, cubic and bbr", info.CongestionControls)
+	}
+}
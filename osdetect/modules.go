@@ -0,0 +1,286 @@
+package osdetect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	modulesLoadDir = "/etc/modules-load.d"
+	modprobeDir    = "/etc/modprobe.d"
+)
+
+// Reasons a kernel module cannot be loaded, wrapped in *ModuleError.
+var (
+	ErrModuleNotFound     = errors.New("module is not available for the running kernel")
+	ErrModulesUnsupported = errors.New("kernel was built without loadable module support")
+	ErrModulesDisabled    = errors.New("module loading is disabled by kernel.modules_disabled")
+	ErrModulesInContainer = errors.New("modules cannot be loaded from inside a container; load it on the host")
+	ErrModuleLockdown     = errors.New("kernel lockdown or signature enforcement rejected the module")
+	ErrModulePermission   = errors.New("loading modules requires root")
+)
+
+var moduleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ModuleError is returned when a kernel module cannot be loaded.
+type ModuleError struct {
+	Module string
+	Err    error // One of the ErrModule* reasons, or *ExitError with modprobe's output
+}
+
+func (e *ModuleError) Error() string {
+	return fmt.Sprintf("failed to load module %s: %v", e.Module, e.Err)
+}
+
+func (e *ModuleError) Unwrap() error {
+	return e.Err
+}
+
+// KernelLockdown returns the host's kernel lockdown mode.
+func KernelLockdown() string {
+	return defaultDetector.KernelLockdown()
+}
+
+// KernelLockdown returns the active mode in /sys/kernel/security/lockdown,
+// "none", "integrity" or "confidentiality", or "" if lockdown is unsupported.
+func (d *Detector) KernelLockdown() string {
+	data, err := d.readFile("/sys/kernel/security/lockdown")
+	if err != nil {
+		return ""
+	}
+	// e.g., "none [integrity] confidentiality"
+	for _, mode := range strings.Fields(string(data)) {
+		if strings.HasPrefix(mode, "[") {
+			return strings.Trim(mode, "[]")
+		}
+	}
+	return ""
+}
+
+// CanLoadModules reports why the host cannot load kernel modules, or nil if it can.
+func CanLoadModules() error {
+	return defaultDetector.CanLoadModules()
+}
+
+// CanLoadModules returns ErrModulesUnsupported, ErrModulesDisabled or
+// ErrModulesInContainer if no module can be loaded, or nil otherwise.
+// Lockdown only rejects unsigned modules, so it is reported by LoadModule.
+func (d *Detector) CanLoadModules() error {
+	if !d.exists("/proc/modules") {
+		if d.InContainer() {
+			return ErrModulesInContainer
+		}
+		return ErrModulesUnsupported
+	}
+	if d.sysctlBool("/proc/sys/kernel/modules_disabled") {
+		return ErrModulesDisabled
+	}
+	if d.InContainer() {
+		return ErrModulesInContainer
+	}
+	return nil
+}
+
+// LoadModule loads a kernel module on the host.
+func LoadModule(ctx context.Context, name string, options ...string) error {
+	return defaultDetector.LoadModule(ctx, name, options...)
+}
+
+// LoadModule loads module name with modprobe, passing options such as
+// "max_part=8". It does nothing if the module is already loaded or built
+// in, in which case options are not applied.
+func (d *Detector) LoadModule(ctx context.Context, name string, options ...string) error {
+	if err := validateModule(name, options); err != nil {
+		return err
+	}
+
+	switch d.KernelModuleStatus(name) {
+	case ModuleLoaded, ModuleBuiltin:
+		return nil
+	case ModuleMissing:
+		// modules.dep may be missing or stale, so only trust it if modprobe can't run
+		if !d.hasCommand("modprobe") {
+			return &ModuleError{Module: name, Err: ErrModuleNotFound}
+		}
+	}
+	if err := d.CanLoadModules(); err != nil {
+		return &ModuleError{Module: name, Err: err}
+	}
+
+	args := append([]string{name}, options...)
+	if _, err := d.runner().Run(ctx, Command("modprobe", args...)); err != nil {
+		return &ModuleError{Module: name, Err: d.modprobeError(err)}
+	}
+	return nil
+}
+
+// modprobeError maps modprobe's output to one of the ErrModule* reasons,
+// returning err unchanged if it is not recognized.
+func (d *Detector) modprobeError(err error) error {
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+
+	stderr := string(exitErr.Stderr)
+	switch {
+	case strings.Contains(stderr, "not found"):
+		return ErrModuleNotFound
+	case strings.Contains(stderr, "Key was rejected") || strings.Contains(stderr, "Required key not available"):
+		return ErrModuleLockdown
+	case strings.Contains(stderr, "Operation not permitted"):
+		// Lockdown and signature enforcement also fail with EPERM
+		if mode := d.KernelLockdown(); mode != "" && mode != "none" {
+			return ErrModuleLockdown
+		}
+		if data, err := d.readFile("/sys/module/module/parameters/sig_enforce"); err == nil && strings.TrimSpace(string(data)) == "Y" {
+			return ErrModuleLockdown
+		}
+		return ErrModulePermission
+	}
+	return err
+}
+
+// validateModule checks a module name and its options, which are written
+// to command lines and configuration files.
+func validateModule(name string, options []string) error {
+	if !moduleNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid module name '%s'", name)
+	}
+	for _, opt := range options {
+		if opt == "" || strings.ContainsAny(opt, " \t\n") || strings.HasPrefix(opt, "-") {
+			return fmt.Errorf("invalid option '%s' for module %s", opt, name)
+		}
+	}
+	return nil
+}
+
+// KernelModules is an application's persistent kernel modules. Modules are
+// listed in /etc/modules-load.d/<owner>.conf to load at boot, and their
+// options are kept in /etc/modprobe.d/<owner>.conf.
+type KernelModules struct {
+	d     *Detector
+	owner string
+}
+
+// NewKernelModules returns the host's persistent kernel modules for owner.
+func NewKernelModules(owner string) *KernelModules {
+	return defaultDetector.KernelModules(owner)
+}
+
+// KernelModules returns the persistent kernel modules for owner beneath the detector's Root.
+func (d *Detector) KernelModules(owner string) *KernelModules {
+	return &KernelModules{d: d, owner: owner}
+}
+
+// LoadPath returns the owner's modules-load.d file.
+func (k *KernelModules) LoadPath() string {
+	return path.Join(modulesLoadDir, k.owner+".conf")
+}
+
+// OptionsPath returns the owner's modprobe.d file.
+func (k *KernelModules) OptionsPath() string {
+	return path.Join(modprobeDir, k.owner+".conf")
+}
+
+// Modules returns the modules loaded at boot for owner, in file order.
+func (k *KernelModules) Modules() ([]string, error) {
+	if !ownerPattern.MatchString(k.owner) {
+		return nil, fmt.Errorf("invalid owner '%s'", k.owner)
+	}
+	data, err := k.d.readFile(k.LoadPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseLines(string(data), func(line string) string {
+		if line[0] == '#' || line[0] == ';' {
+			return ""
+		}
+		return line
+	}), nil
+}
+
+// Load loads module name now and at every boot. Options replace any the
+// owner set for the module before; they take effect when the module is
+// next loaded, so they are not applied if it is already loaded.
+func (k *KernelModules) Load(ctx context.Context, name string, options ...string) error {
+	modules, err := k.Modules()
+	if err != nil {
+		return err
+	}
+	if err := k.d.LoadModule(ctx, name, options...); err != nil {
+		return err
+	}
+
+	found := false
+	for _, m := range modules {
+		found = found || m == name
+	}
+	if !found {
+		modules = append(modules, name)
+	}
+	if err := k.writeLoad(modules); err != nil {
+		return err
+	}
+	return k.writeOptions(name, options)
+}
+
+// Remove deletes the owner's modules-load.d and modprobe.d files. Modules
+// are not unloaded, since other software may be using them.
+func (k *KernelModules) Remove() error {
+	if !ownerPattern.MatchString(k.owner) {
+		return fmt.Errorf("invalid owner '%s'", k.owner)
+	}
+	if _, err := k.d.removeFile(k.LoadPath()); err != nil {
+		return err
+	}
+	_, err := k.d.removeFile(k.OptionsPath())
+	return err
+}
+
+// writeLoad replaces the owner's modules-load.d file with modules.
+func (k *KernelModules) writeLoad(modules []string) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "# Managed by %s; removed on uninstall.\n", k.owner)
+	for _, m := range modules {
+		buf.WriteString(m + "\n")
+	}
+	_, err := k.d.writeFile(k.LoadPath(), []byte(buf.String()), 0644)
+	return err
+}
+
+// writeOptions sets the options line for module name in the owner's
+// modprobe.d file, deleting the file once no module has options.
+func (k *KernelModules) writeOptions(name string, options []string) error {
+	var lines []string
+	data, err := k.d.readFile(k.OptionsPath())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, line := range parseLines(string(data), nil) {
+		fields := strings.Fields(line)
+		if line[0] == '#' || (len(fields) >= 2 && fields[0] == "options" && moduleName(fields[1]) == moduleName(name)) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(options) > 0 {
+		lines = append(lines, "options "+name+" "+strings.Join(options, " "))
+	}
+
+	if len(lines) == 0 {
+		_, err := k.d.removeFile(k.OptionsPath())
+		return err
+	}
+	content := fmt.Sprintf("# Managed by %s; removed on uninstall.\n%s\n", k.owner, strings.Join(lines, "\n"))
+	_, err = k.d.writeFile(k.OptionsPath(), []byte(content), 0644)
+	return err
+}
@@ -0,0 +1,163 @@
+package osdetect
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestKernelModulesFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "proc/modules", "")
+	writeTestFile(t, root, "proc/sys/kernel/osrelease", "6.8.0-45-generic\n")
+	writeTestFile(t, root, "lib/modules/6.8.0-45-generic/modules.dep",
+		"kernel/drivers/block/loop.ko.zst:\nkernel/drivers/block/nbd.ko.zst:\n")
+
+	r := &RecordingRunner{Paths: map[string]string{"modprobe": "/usr/sbin/modprobe"}}
+	d := NewRootDetector(root)
+	d.Runner = r
+	k := d.KernelModules("myapp")
+	ctx := context.Background()
+
+	readFile := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if err := k.Load(ctx, "nbd", "nbds_max=4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Load(ctx, "loop", "max_part=8"); err != nil {
+		t.Fatal(err)
+	}
+	wantLoad := "# Managed by myapp; removed on uninstall.\nnbd\nloop\n"
+	wantOptions := "# Managed by myapp; removed on uninstall.\noptions nbd nbds_max=4\noptions loop max_part=8\n"
+	if got := readFile("etc/modules-load.d/myapp.conf"); got != wantLoad {
+		t.Errorf("modules-load.d =\n%s\nwant\n%s", got, wantLoad)
+	}
+	if got := readFile("etc/modprobe.d/myapp.conf"); got != wantOptions {
+		t.Errorf("modprobe.d =\n%s\nwant\n%s", got, wantOptions)
+	}
+	if want := []string{"modprobe nbd nbds_max=4", "modprobe loop max_part=8"}; !reflect.DeepEqual(r.CommandLines(), want) {
+		t.Errorf("commands = %q, want %q", r.CommandLines(), want)
+	}
+
+	// Loading again with the same options rewrites nothing
+	info, err := os.Stat(filepath.Join(root, "etc/modprobe.d/myapp.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Load(ctx, "loop", "max_part=8"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile("etc/modprobe.d/myapp.conf"); got != wantOptions {
+		t.Errorf("modprobe.d after reload =\n%s\nwant\n%s", got, wantOptions)
+	}
+	if again, err := os.Stat(filepath.Join(root, "etc/modprobe.d/myapp.conf")); err != nil || !again.ModTime().Equal(info.ModTime()) {
+		t.Errorf("modprobe.d was rewritten: %v", err)
+	}
+	if modules, err := k.Modules(); err != nil || !reflect.DeepEqual(modules, []string{"nbd", "loop"}) {
+		t.Errorf("Modules() = %q, %v, want [nbd loop]", modules, err)
+	}
+
+	// Options for one module are dropped without touching the other's, and
+	// the file goes once no module has options
+	if err := k.Load(ctx, "nbd"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFile("etc/modprobe.d/myapp.conf"), "# Managed by myapp; removed on uninstall.\noptions loop max_part=8\n"; got != want {
+		t.Errorf("modprobe.d =\n%s\nwant\n%s", got, want)
+	}
+	if err := k.Load(ctx, "loop"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "etc/modprobe.d/myapp.conf")); !os.IsNotExist(err) {
+		t.Errorf("modprobe.d still exists without options: %v", err)
+	}
+
+	if err := k.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "etc/modules-load.d/myapp.conf")); !os.IsNotExist(err) {
+		t.Errorf("modules-load.d still exists after Remove: %v", err)
+	}
+	if err := k.Remove(); err != nil {
+		t.Errorf("Remove() again = %v, want nil", err)
+	}
+}
+
+func TestLoadModuleErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		stderr   string
+		lockdown string
+		enforce  string
+		want     error
+	}{
+		{"not found", "modprobe: FATAL: Module nope not found in directory /lib/modules/6.8.0-45-generic", "", "", ErrModuleNotFound},
+		{"key rejected", "modprobe: ERROR: could not insert 'nope': Key was rejected by service", "", "", ErrModuleLockdown},
+		{"lockdown", "modprobe: ERROR: could not insert 'nope': Operation not permitted", "none [integrity] confidentiality", "", ErrModuleLockdown},
+		{"sig_enforce", "modprobe: ERROR: could not insert 'nope': Operation not permitted", "[none] integrity confidentiality", "Y", ErrModuleLockdown},
+		{"not root", "modprobe: ERROR: could not insert 'nope': Operation not permitted", "[none] integrity confidentiality", "N", ErrModulePermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := fstest.MapFS{"proc/modules": {Data: []byte{}}}
+			if tt.lockdown != "" {
+				files["sys/kernel/security/lockdown"] = &fstest.MapFile{Data: []byte(tt.lockdown + "\n")}
+			}
+			if tt.enforce != "" {
+				files["sys/module/module/parameters/sig_enforce"] = &fstest.MapFile{Data: []byte(tt.enforce + "\n")}
+			}
+			r := &RecordingRunner{
+				Paths: map[string]string{"modprobe": "/usr/sbin/modprobe"},
+				Handler: func(Cmd) (*Result, error) {
+					return &Result{ExitCode: 1, Stderr: []byte(tt.stderr)}, nil
+				},
+			}
+			d := NewDetector(files)
+			d.Runner = r
+
+			err := d.LoadModule(context.Background(), "nope")
+			var modErr *ModuleError
+			if !errors.As(err, &modErr) || modErr.Module != "nope" || !errors.Is(err, tt.want) {
+				t.Errorf("LoadModule() = %v, want *ModuleError wrapping %v", err, tt.want)
+			}
+			if want := []string{"modprobe nope"}; !reflect.DeepEqual(r.CommandLines(), want) {
+				t.Errorf("commands = %q, want %q", r.CommandLines(), want)
+			}
+		})
+	}
+
+	// Unrecognised failures keep modprobe's output
+	d := NewDetector(fstest.MapFS{"proc/modules": {Data: []byte{}}})
+	d.Runner = &RecordingRunner{
+		Paths: map[string]string{"modprobe": "/usr/sbin/modprobe"},
+		Handler: func(Cmd) (*Result, error) {
+			return &Result{ExitCode: 1, Stderr: []byte("modprobe: ERROR: could not insert 'nope': Invalid argument")}, nil
+		},
+	}
+	var exitErr *ExitError
+	if err := d.LoadModule(context.Background(), "nope"); !errors.As(err, &exitErr) {
+		t.Errorf("LoadModule() = %v, want *ExitError", err)
+	}
+
+	// Already loaded modules are not probed
+	r := &RecordingRunner{Paths: map[string]string{"modprobe": "/usr/sbin/modprobe"}}
+	d = NewDetector(fstest.MapFS{"proc/modules": {Data: []byte("loop 40960 0 - Live 0x0000000000000000\n")}})
+	d.Runner = r
+	if err := d.LoadModule(context.Background(), "loop"); err != nil || len(r.CommandLines()) != 0 {
+		t.Errorf("LoadModule(loaded) = %v, commands %q", err, r.CommandLines())
+	}
+	if err := d.LoadModule(context.Background(), "loop", "-v"); err == nil {
+		t.Error("LoadModule accepted an option starting with '-'")
+	}
+}
@@ -2,144 +2,302 @@
 package osdetect
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"os"
-	"os/exec"
-	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 // ErrNotRoot is returned when root privileges are required but not present.
 var ErrNotRoot = errors.New("this program must be run as root")
 
 // OSInfo contains detected OS information.
+// Fields mirror the os-release keys described in os-release(5).
 type OSInfo struct {
-	ID             string // e.g., "fedora", "ubuntu", "debian"
-	IDLike         string // e.g., "rhel fedora", "debian"
-	PrettyName     string // e.g., "Fedora Linux 39"
-	VersionID      string // e.g., "39", "22.04"
-	PackageManager string // "dnf", "apt", "yum", "pacman", "zypper", "apk"
-	InstallCmd     string // Full install command, e.g., "dnf install -y"
+	ID               string // e.g., "fedora", "ubuntu", "debian"
+	IDLike           string // e.g., "rhel fedora", "debian"
+	Name             string // e.g., "Fedora Linux"
+	PrettyName       string // e.g., "Fedora Linux 39"
+	Version          string // e.g., "22.04.3 LTS (Jammy Jellyfish)"
+	VersionID        string // e.g., "39", "22.04"
+	VersionCodename  string // e.g., "jammy", "bookworm"
+	Variant          string // e.g., "Server Edition"
+	VariantID        string // e.g., "server", "workstation"
+	BuildID          string // e.g., "2024-01-01.1"
+	ImageID          string
+	ImageVersion     string
+	ReleaseType      string // "stable", "lts", "development" or "experimental"
+	CPEName          string // e.g., "cpe:/o:fedoraproject:fedora:39"
+	HomeURL          string
+	DocumentationURL string
+	SupportURL       string
+	BugReportURL     string
+	PrivacyPolicyURL string
+	SupportEnd       string // YYYY-MM-DD end of support date
+	Logo             string
+	AnsiColor        string
+	VendorName       string
+	VendorURL        string
+	DefaultHostname  string
+	Architecture     string
+	SysextLevel      string
+	ConfextLevel     string
+	SysextScope      string
+	ConfextScope     string
+	PortablePrefixes string
+
+	// Raw holds every key/value pair read from Source, including
+	// vendor extensions such as UBUNTU_CODENAME.
+	Raw map[string]string
+	// Source is the file the information was read from.
+	Source string
+
+	// PackageManager is the detected package manager backend, or nil
+	// if none could be determined.
+	PackageManager PackageManager
 }
 
-// Detect reads /etc/os-release and determines package manager.
+// Detect reads os-release on the host and determines package manager.
 func Detect() (*OSInfo, error) {
-	info := &OSInfo{}
+	return defaultDetector.Detect()
+}
 
-	data, err := os.ReadFile("/etc/os-release")
+// Detect reads /etc/os-release, falling back to /usr/lib/os-release and
+// then /etc/lsb-release, and determines package manager.
+func (d *Detector) Detect() (*OSInfo, error) {
+	info, err := d.readOSRelease()
 	if err != nil {
 		return nil, err
 	}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "ID=") {
-			info.ID = strings.Trim(strings.TrimPrefix(line, "ID="), "\"")
-		}
-		if strings.HasPrefix(line, "ID_LIKE=") {
-			info.IDLike = strings.Trim(strings.TrimPrefix(line, "ID_LIKE="), "\"")
-		}
-		if strings.HasPrefix(line, "PRETTY_NAME=") {
-			info.PrettyName = strings.Trim(strings.TrimPrefix(line, "PRETTY_NAME="), "\"")
-		}
-		if strings.HasPrefix(line, "VERSION_ID=") {
-			info.VersionID = strings.Trim(strings.TrimPrefix(line, "VERSION_ID="), "\"")
-		}
+	if name := d.detectPackageManager(info.ID, info.IDLike); name != "" {
+		info.PackageManager, _ = d.NewPackageManager(name)
 	}
 
-	info.PackageManager, info.InstallCmd = detectPackageManager(info.ID, info.IDLike)
-
 	return info, nil
 }
 
-// detectPackageManager determines the package manager based on OS ID.
-func detectPackageManager(id, idLike string) (manager, installCmd string) {
+// detectPackageManager determines the package manager name based on OS ID.
+func (d *Detector) detectPackageManager(id, idLike string) string {
 	switch id {
 	case "fedora", "rhel", "centos", "rocky", "alma", "ol":
 		// Check if dnf is available, fallback to yum
-		if _, err := exec.LookPath("dnf"); err == nil {
-			return "dnf", "dnf install -y"
+		if d.hasCommand("dnf") {
+			return "dnf"
 		}
-		if _, err := exec.LookPath("yum"); err == nil {
-			return "yum", "yum install -y"
+		if d.hasCommand("yum") {
+			return "yum"
 		}
-		return "dnf", "dnf install -y"
+		return "dnf"
 
 	case "debian", "ubuntu", "linuxmint", "pop":
-		return "apt", "apt-get install -y"
+		return "apt"
 
 	case "arch", "manjaro", "endeavouros":
-		return "pacman", "pacman -S --noconfirm"
+		return "pacman"
 
 	case "opensuse", "opensuse-leap", "opensuse-tumbleweed", "sles":
-		return "zypper", "zypper install -y"
+		return "zypper"
 
 	case "alpine":
-		return "apk", "apk add"
+		return "apk"
 	}
 
 	// Try to detect from ID_LIKE
 	if strings.Contains(idLike, "debian") || strings.Contains(idLike, "ubuntu") {
-		return "apt", "apt-get install -y"
+		return "apt"
 	}
 	if strings.Contains(idLike, "fedora") || strings.Contains(idLike, "rhel") {
-		if _, err := exec.LookPath("dnf"); err == nil {
-			return "dnf", "dnf install -y"
+		if d.hasCommand("dnf") {
+			return "dnf"
 		}
-		return "yum", "yum install -y"
+		return "yum"
 	}
 	if strings.Contains(idLike, "arch") {
-		return "pacman", "pacman -S --noconfirm"
+		return "pacman"
+	}
+	if strings.Contains(idLike, "suse") {
+		return "zypper"
 	}
 
 	// Fallback: try to detect by available commands
 	managers := []struct {
-		cmd        string
-		name       string
-		installCmd string
+		cmd  string
+		name string
 	}{
-		{"apt", "apt", "apt-get install -y"},
-		{"dnf", "dnf", "dnf install -y"},
-		{"yum", "yum", "yum install -y"},
-		{"pacman", "pacman", "pacman -S --noconfirm"},
-		{"zypper", "zypper", "zypper install -y"},
-		{"apk", "apk", "apk add"},
+		{"apt-get", "apt"},
+		{"dnf", "dnf"},
+		{"yum", "yum"},
+		{"pacman", "pacman"},
+		{"zypper", "zypper"},
+		{"apk", "apk"},
 	}
 
 	for _, m := range managers {
-		if _, err := exec.LookPath(m.cmd); err == nil {
-			return m.name, m.installCmd
+		if d.hasCommand(m.cmd) {
+			return m.name
 		}
 	}
 
-	return "unknown", ""
+	return ""
 }
 
 // InstallPackage installs a package using the detected package manager.
 func (o *OSInfo) InstallPackage(pkg string) error {
-	if o.InstallCmd == "" {
+	return o.InstallPackages(context.Background(), pkg)
+}
+
+// InstallPackages installs pkgs in a single package manager transaction,
+// skipping any that are already installed. Names are resolved with
+// ResolvePackage, so callers can pass logical names such as "dnsutils".
+// For apt and apk, whose local index can be missing or stale, the index is
+// refreshed before the first install in the process. Other backends are
+// not refreshed: pacman would perform an unsupported partial upgrade, and
+// dnf, yum and zypper refresh expired metadata themselves.
+// Command failures are returned wrapping *ExitError with the captured output.
+func (o *OSInfo) InstallPackages(ctx context.Context, pkgs ...string) error {
+	if o.PackageManager == nil {
 		return fmt.Errorf("could not detect package manager for OS '%s'", o.ID)
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Skip packages that are already present; install anything we cannot query
+	var missing []string
+	for _, pkg := range o.resolvePackages(pkgs) {
+		if ok, err := o.PackageManager.IsInstalled(ctx, pkg); err != nil || !ok {
+			missing = append(missing, pkg)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	pkgs = missing
+
+	if refreshBeforeInstall(o.PackageManager) {
+		if err := refreshIndexOnce(ctx, o.PackageManager); err != nil {
+			return fmt.Errorf("failed to refresh package index: %w", err)
+		}
+	}
+
+	if err := o.PackageManager.Install(ctx, pkgs...); err != nil {
+		return fmt.Errorf("failed to install %s: %w", strings.Join(pkgs, ", "), err)
+	}
+	return nil
+}
+
+// IsInstalled reports whether pkg is installed. Logical names are resolved
+// with ResolvePackage.
+func (o *OSInfo) IsInstalled(ctx context.Context, pkg string) (bool, error) {
+	if o.PackageManager == nil {
+		return false, fmt.Errorf("could not detect package manager for OS '%s'", o.ID)
+	}
+	return o.PackageManager.IsInstalled(ctx, o.ResolvePackage(pkg))
+}
+
+// InstalledVersion returns the parsed installed version of pkg, or ErrNotInstalled.
+func (o *OSInfo) InstalledVersion(ctx context.Context, pkg string) (Version, error) {
+	if o.PackageManager == nil {
+		return Version{}, fmt.Errorf("could not detect package manager for OS '%s'", o.ID)
+	}
+	raw, err := o.PackageManager.InstalledVersion(ctx, o.ResolvePackage(pkg))
+	if err != nil {
+		return Version{}, err
+	}
+	return ParseVersion(raw)
+}
+
+// MissingPackages returns the subset of pkgs that is not installed,
+// as passed in before name resolution.
+func (o *OSInfo) MissingPackages(ctx context.Context, pkgs ...string) ([]string, error) {
+	var missing []string
+	for _, pkg := range pkgs {
+		ok, err := o.IsInstalled(ctx, pkg)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			missing = append(missing, pkg)
+		}
+	}
+	return missing, nil
+}
+
+// VersionError is returned when an installed package is older than required.
+type VersionError struct {
+	Package   string
+	Installed Version
+	Required  Version
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%s %s is installed but %s or newer is required", e.Package, e.Installed, e.Required)
+}
+
+// RequireVersion checks that pkg is installed at version min or newer.
+// If min has no release, any release of that version is accepted, so
+// "1.2" is satisfied by "1.2-1". It returns ErrNotInstalled or
+// *VersionError otherwise.
+func (o *OSInfo) RequireVersion(ctx context.Context, pkg, min string) error {
+	required, err := ParseVersion(min)
+	if err != nil {
+		return err
+	}
+	installed, err := o.InstalledVersion(ctx, pkg)
+	if err != nil {
+		return err
+	}
+	compared := installed
+	if required.Release == "" {
+		compared.Release = ""
+	}
+	if compared.Compare(required) < 0 {
+		return &VersionError{Package: pkg, Installed: installed, Required: required}
+	}
+	return nil
+}
+
+var (
+	refreshMu sync.Mutex
+	refreshed = make(map[string]bool)
+)
 
-	// Update package cache for apt
-	if o.PackageManager == "apt" {
-		cmd := exec.Command("apt-get", "update", "-qq")
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Run() // Ignore errors from update
+// refreshBeforeInstall reports whether InstallPackages should refresh pm's
+// index first.
+func refreshBeforeInstall(pm PackageManager) bool {
+	switch pm.Name() {
+	case "apt", "apk":
+		return true
 	}
+	return false
+}
+
+// refreshIndexOnce refreshes the package index unless it has already been
+// refreshed successfully by this process.
+func refreshIndexOnce(ctx context.Context, pm PackageManager) error {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
 
-	// Split the install command and append the package
-	parts := strings.Fields(o.InstallCmd)
-	parts = append(parts, pkg)
+	if refreshed[pm.Name()] {
+		return nil
+	}
+	if err := pm.RefreshIndex(ctx); err != nil {
+		return err
+	}
+	refreshed[pm.Name()] = true
+	return nil
+}
 
-	cmd := exec.Command(parts[0], parts[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+// invalidateIndex forces the next refreshIndexOnce call for pm to refresh,
+// e.g. after its repositories change.
+func invalidateIndex(pm PackageManager) {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+	delete(refreshed, pm.Name())
 }
 
 // IsRoot checks if running as root (uid == 0).
@@ -156,90 +314,67 @@ func RequireRoot() error {
 	return nil
 }
 
-// HasSystemd checks if systemctl is available.
+// HasSystemd checks if systemctl is available on the host.
 func HasSystemd() bool {
-	_, err := exec.LookPath("systemctl")
-	return err == nil
+	return defaultDetector.HasSystemd()
+}
+
+// HasSystemd checks if systemctl is available.
+func (d *Detector) HasSystemd() bool {
+	return d.hasCommand("systemctl")
 }
 
-// GetArch returns the system architecture in common naming (amd64, arm64, armv7, 386).
+// GetArch returns the machine architecture in release asset naming (amd64, arm64, armv7, 386).
 func GetArch() string {
-	return runtime.GOARCH
+	return MachineArch().Asset()
 }
 
-// HasIPv6 checks if IPv6 is available on any interface.
+// HasIPv6 reports whether the host has working global IPv6: a globally
+// routable address and an IPv6 default route. Link-local and ULA
+// addresses alone do not count.
 func HasIPv6() bool {
-	ifaces, err := net.Interfaces()
-	if err != nil {
-		return false
-	}
-
-	for _, iface := range ifaces {
-		if iface.Flags&net.FlagLoopback != 0 {
-			continue
-		}
-		if iface.Flags&net.FlagUp == 0 {
-			continue
-		}
-
-		addrs, err := iface.Addrs()
-		if err != nil {
-			continue
-		}
-
-		for _, addr := range addrs {
-			if ipnet, ok := addr.(*net.IPNet); ok {
-				if ipnet.IP.To4() == nil && ipnet.IP.To16() != nil {
-					return true
-				}
-			}
-		}
-	}
+	return defaultDetector.HasIPv6()
+}
 
-	return false
+// HasIPv6 reports whether DetectIPv6 finds working global IPv6.
+func (d *Detector) HasIPv6() bool {
+	status, err := d.DetectIPv6()
+	return err == nil && status.HasGlobal()
 }
 
-// GetDefaultInterface returns the default network interface name.
+// GetDefaultInterface returns the host's default network interface name.
 func GetDefaultInterface() (string, error) {
-	file, err := os.Open("/proc/net/route")
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	scanner.Scan() // skip header
+	return defaultDetector.GetDefaultInterface()
+}
 
-	for scanner.Scan() {
-		fields := strings.Fields(scanner.Text())
-		if len(fields) >= 2 && fields[1] == "00000000" {
-			return fields[0], nil
+// GetDefaultInterface returns the network interface carrying the IPv4
+// default route, or the IPv6 one on IPv6-only hosts. It returns "" if
+// there is no default route.
+func (d *Detector) GetDefaultInterface() (string, error) {
+	for _, family := range []AddrFamily{IPv4, IPv6} {
+		route, err := d.DefaultRoute(family)
+		if errors.Is(err, ErrNoDefaultRoute) {
+			continue
 		}
+		if err != nil {
+			return "", err
+		}
+		return route.Interface, nil
 	}
-
-	return "", scanner.Err()
+	return "", nil
 }
 
-// DetectSSHPort reads the SSH port from sshd_config.
+// DetectSSHPort reads the SSH port from the host's sshd_config.
 func DetectSSHPort() string {
-	file, err := os.Open("/etc/ssh/sshd_config")
+	return defaultDetector.DetectSSHPort()
+}
+
+// DetectSSHPort returns the first port sshd listens on according to
+// sshd_config and its includes, or "22" if it cannot be read.
+func (d *Detector) DetectSSHPort() string {
+	cfg, err := d.ReadSSHDConfig()
 	if err != nil {
 		return "22"
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		fields := strings.Fields(line)
-		if len(fields) >= 2 && strings.ToLower(fields[0]) == "port" {
-			return fields[1]
-		}
-	}
-
-	return "22"
+	return strconv.Itoa(cfg.ListenPorts()[0])
 }
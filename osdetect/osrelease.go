@@ -0,0 +1,205 @@
+package osdetect
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// osReleasePaths lists the os-release locations in the order os-release(5) requires.
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// lsbReleasePath is read when no os-release file exists.
+const lsbReleasePath = "/etc/lsb-release"
+
+// ParseOSRelease parses an os-release(5) formatted stream into a key/value map.
+// Values follow shell quoting rules: they may be single- or double-quoted,
+// and backslash escapes are honoured. Blank lines, comments and malformed
+// lines are skipped.
+func ParseOSRelease(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || !validOSReleaseKey(key) {
+			continue
+		}
+
+		value, err := unquoteShell(value)
+		if err != nil {
+			continue
+		}
+		values[key] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// validOSReleaseKey reports whether key is a valid shell variable name.
+func validOSReleaseKey(key string) bool {
+	if key == "" || (key[0] >= '0' && key[0] <= '9') {
+		return false
+	}
+	for _, c := range key {
+		if !(c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// unquoteShell expands a shell-style value made of unquoted, single-quoted
+// and double-quoted segments.
+func unquoteShell(s string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return "", errors.New("unterminated single quote")
+			}
+			b.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+
+		case '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				// Inside double quotes only these characters may be escaped
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$\"\\`", s[i+1]) >= 0 {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return "", errors.New("unterminated double quote")
+			}
+
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// readOSRelease reads the first available os-release file, falling back to lsb-release.
+func (d *Detector) readOSRelease() (*OSInfo, error) {
+	for _, path := range osReleasePaths {
+		data, err := d.readFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := ParseOSRelease(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return newOSInfo(path, values, values), nil
+	}
+
+	data, err := d.readFile(lsbReleasePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("no os-release or lsb-release file found: %w", err)
+		}
+		return nil, err
+	}
+
+	values, err := ParseOSRelease(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", lsbReleasePath, err)
+	}
+	return newOSInfo(lsbReleasePath, fromLSBRelease(values), values), nil
+}
+
+// fromLSBRelease translates lsb-release keys to their os-release equivalents.
+func fromLSBRelease(lsb map[string]string) map[string]string {
+	return map[string]string{
+		"ID":               strings.ToLower(lsb["DISTRIB_ID"]),
+		"NAME":             lsb["DISTRIB_ID"],
+		"VERSION_ID":       lsb["DISTRIB_RELEASE"],
+		"VERSION_CODENAME": lsb["DISTRIB_CODENAME"],
+		"PRETTY_NAME":      lsb["DISTRIB_DESCRIPTION"],
+	}
+}
+
+// newOSInfo builds an OSInfo from os-release values, applying the defaults from os-release(5).
+func newOSInfo(source string, values, raw map[string]string) *OSInfo {
+	info := &OSInfo{
+		ID:               values["ID"],
+		IDLike:           values["ID_LIKE"],
+		Name:             values["NAME"],
+		PrettyName:       values["PRETTY_NAME"],
+		Version:          values["VERSION"],
+		VersionID:        values["VERSION_ID"],
+		VersionCodename:  values["VERSION_CODENAME"],
+		Variant:          values["VARIANT"],
+		VariantID:        values["VARIANT_ID"],
+		BuildID:          values["BUILD_ID"],
+		ImageID:          values["IMAGE_ID"],
+		ImageVersion:     values["IMAGE_VERSION"],
+		ReleaseType:      values["RELEASE_TYPE"],
+		CPEName:          values["CPE_NAME"],
+		HomeURL:          values["HOME_URL"],
+		DocumentationURL: values["DOCUMENTATION_URL"],
+		SupportURL:       values["SUPPORT_URL"],
+		BugReportURL:     values["BUG_REPORT_URL"],
+		PrivacyPolicyURL: values["PRIVACY_POLICY_URL"],
+		SupportEnd:       values["SUPPORT_END"],
+		Logo:             values["LOGO"],
+		AnsiColor:        values["ANSI_COLOR"],
+		VendorName:       values["VENDOR_NAME"],
+		VendorURL:        values["VENDOR_URL"],
+		DefaultHostname:  values["DEFAULT_HOSTNAME"],
+		Architecture:     values["ARCHITECTURE"],
+		SysextLevel:      values["SYSEXT_LEVEL"],
+		ConfextLevel:     values["CONFEXT_LEVEL"],
+		SysextScope:      values["SYSEXT_SCOPE"],
+		ConfextScope:     values["CONFEXT_SCOPE"],
+		PortablePrefixes: values["PORTABLE_PREFIXES"],
+		Raw:              raw,
+		Source:           source,
+	}
+
+	if info.ID == "" {
+		info.ID = "linux"
+	}
+	if info.Name == "" {
+		info.Name = "Linux"
+	}
+	if info.PrettyName == "" {
+		info.PrettyName = "Linux"
+	}
+	// Older Ubuntu releases only provide the vendor-specific key
+	if info.VersionCodename == "" {
+		info.VersionCodename = values["UBUNTU_CODENAME"]
+	}
+
+	return info
+}
+
+// IDLikeList returns ID_LIKE split into individual distribution IDs.
+func (o *OSInfo) IDLikeList() []string {
+	return strings.Fields(o.IDLike)
+}
@@ -0,0 +1,160 @@
+package osdetect
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseOSRelease(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		key   string
+		want  string
+	}{
+		{"unquoted", "ID=ubuntu\n", "ID", "ubuntu"},
+		{"double quoted", `PRETTY_NAME="Ubuntu 22.04.3 LTS"`, "PRETTY_NAME", "Ubuntu 22.04.3 LTS"},
+		{"single quoted", `NAME='Fedora Linux'`, "NAME", "Fedora Linux"},
+		{"escaped quote", `NAME="Foo \"Bar\""`, "NAME", `Foo "Bar"`},
+		{"mixed segments", `VERSION="22.04"' LTS'`, "VERSION", "22.04 LTS"},
+		{"surrounding whitespace", "  ID=debian  \n", "ID", "debian"},
+		{"comment skipped", "# ID=arch\nID=alpine\n", "ID", "alpine"},
+		{"later value wins", "ID=a\nID=b\n", "ID", "b"},
+		{"empty value", "VARIANT=\n", "VARIANT", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := ParseOSRelease(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := values[tt.key]
+			if !ok {
+				t.Fatalf("key %s missing from %v", tt.key, values)
+			}
+			if got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOSReleaseSkipsMalformed(t *testing.T) {
+	input := "no equals sign\n1ID=digit\nBAD-KEY=x\nOPEN=\"unterminated\nID=ok\n"
+	values, err := ParseOSRelease(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values["ID"] != "ok" {
+		t.Errorf("got %v, want only ID=ok", values)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      fstest.MapFS
+		paths      map[string]string
+		wantID     string
+		wantSource string
+		wantPM     string
+		wantCode   string
+	}{
+		{
+			name: "etc os-release",
+			files: fstest.MapFS{
+				"etc/os-release":     {Data: []byte("ID=ubuntu\nID_LIKE=debian\nVERSION_ID=\"22.04\"\nUBUNTU_CODENAME=jammy\n")},
+				"usr/lib/os-release": {Data: []byte("ID=fedora\n")},
+			},
+			wantID:     "ubuntu",
+			wantSource: "/etc/os-release",
+			wantPM:     "apt",
+			wantCode:   "jammy",
+		},
+		{
+			name: "usr lib fallback",
+			files: fstest.MapFS{
+				"usr/lib/os-release": {Data: []byte("ID=fedora\nVERSION_ID=39\n")},
+			},
+			paths:      map[string]string{"yum": "/usr/bin/yum"},
+			wantID:     "fedora",
+			wantSource: "/usr/lib/os-release",
+			wantPM:     "yum",
+		},
+		{
+			name: "lsb-release fallback",
+			files: fstest.MapFS{
+				"etc/lsb-release": {Data: []byte("DISTRIB_ID=Ubuntu\nDISTRIB_RELEASE=20.04\nDISTRIB_CODENAME=focal\nDISTRIB_DESCRIPTION=\"Ubuntu 20.04.6 LTS\"\n")},
+			},
+			wantID:     "ubuntu",
+			wantSource: "/etc/lsb-release",
+			wantPM:     "apt",
+			wantCode:   "focal",
+		},
+		{
+			name: "derivative via ID_LIKE",
+			files: fstest.MapFS{
+				"etc/os-release": {Data: []byte("ID=zorin\nID_LIKE=\"ubuntu debian\"\n")},
+			},
+			wantID:     "zorin",
+			wantSource: "/etc/os-release",
+			wantPM:     "apt",
+		},
+		{
+			name: "alpine",
+			files: fstest.MapFS{
+				"etc/os-release": {Data: []byte("ID=alpine\nVERSION_ID=3.19.1\n")},
+			},
+			wantID:     "alpine",
+			wantSource: "/etc/os-release",
+			wantPM:     "apk",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(tt.files)
+			d.Runner = &RecordingRunner{Paths: tt.paths}
+
+			info, err := d.Detect()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.ID != tt.wantID {
+				t.Errorf("ID = %q, want %q", info.ID, tt.wantID)
+			}
+			if info.Source != tt.wantSource {
+				t.Errorf("Source = %q, want %q", info.Source, tt.wantSource)
+			}
+			if info.VersionCodename != tt.wantCode {
+				t.Errorf("VersionCodename = %q, want %q", info.VersionCodename, tt.wantCode)
+			}
+			if info.PackageManager == nil {
+				t.Fatalf("PackageManager = nil, want %s", tt.wantPM)
+			}
+			if got := info.PackageManager.Name(); got != tt.wantPM {
+				t.Errorf("PackageManager = %q, want %q", got, tt.wantPM)
+			}
+		})
+	}
+}
+
+func TestDetectNoReleaseFile(t *testing.T) {
+	d := NewDetector(fstest.MapFS{})
+	if _, err := d.Detect(); err == nil {
+		t.Fatal("Detect succeeded without any release file")
+	}
+}
+
+func TestDetectDefaults(t *testing.T) {
+	d := NewDetector(fstest.MapFS{"etc/os-release": {Data: []byte("VERSION_ID=1\n")}})
+	d.Runner = &RecordingRunner{}
+
+	info, err := d.Detect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "linux" || info.Name != "Linux" || info.PrettyName != "Linux" {
+		t.Errorf("got ID=%q Name=%q PrettyName=%q, want os-release(5) defaults", info.ID, info.Name, info.PrettyName)
+	}
+}
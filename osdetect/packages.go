@@ -0,0 +1,107 @@
+package osdetect
+
+import "sync"
+
+// PackageNames maps a distribution ID (e.g., "ubuntu", "rhel") or package
+// manager name (e.g., "dnf", "apk") to the package name used there.
+// The empty key holds the default name.
+type PackageNames map[string]string
+
+var (
+	packagesMu sync.RWMutex
+
+	// packages holds built-in names for common networking tools, keyed by logical name.
+	packages = map[string]PackageNames{
+		"dnsutils": {
+			"":       "dnsutils",
+			"dnf":    "bind-utils",
+			"yum":    "bind-utils",
+			"zypper": "bind-utils",
+			"apk":    "bind-tools",
+			"pacman": "bind",
+		},
+		"iproute2": {
+			"":    "iproute2",
+			"dnf": "iproute",
+			"yum": "iproute",
+		},
+		"iputils-ping": {
+			"":    "iputils",
+			"apt": "iputils-ping",
+		},
+		"netcat": {
+			"":       "netcat-openbsd",
+			"dnf":    "nmap-ncat",
+			"yum":    "nmap-ncat",
+			"pacman": "openbsd-netcat",
+		},
+		"net-tools": {
+			"":       "net-tools",
+			"zypper": "net-tools-deprecated",
+		},
+		"conntrack": {
+			"":    "conntrack-tools",
+			"apt": "conntrack",
+		},
+		"mtr": {
+			"":    "mtr",
+			"apt": "mtr-tiny",
+		},
+		"openssh-server": {
+			"":       "openssh-server",
+			"pacman": "openssh",
+		},
+		"cron": {
+			"":    "cronie",
+			"apt": "cron",
+		},
+	}
+)
+
+// RegisterPackage registers the per-distribution names of a logical
+// package, replacing any existing entry. Applications can use this to
+// add their own dependencies or override the built-in mappings.
+func RegisterPackage(logical string, names PackageNames) {
+	packagesMu.Lock()
+	defer packagesMu.Unlock()
+
+	copied := make(PackageNames, len(names))
+	for k, v := range names {
+		copied[k] = v
+	}
+	packages[logical] = copied
+}
+
+// ResolvePackage returns the package name for logical on this system.
+// Lookup order is the distribution ID, each ID_LIKE entry, the package
+// manager name, then the default. Unregistered names are returned as-is.
+func (o *OSInfo) ResolvePackage(logical string) string {
+	packagesMu.RLock()
+	names, ok := packages[logical]
+	packagesMu.RUnlock()
+	if !ok {
+		return logical
+	}
+
+	keys := append([]string{o.ID}, o.IDLikeList()...)
+	if o.PackageManager != nil {
+		keys = append(keys, o.PackageManager.Name())
+	}
+	keys = append(keys, "")
+
+	for _, key := range keys {
+		if name, ok := names[key]; ok {
+			return name
+		}
+	}
+	return logical
+}
+
+// resolvePackages maps each logical name to its package name on this system.
+func (o *OSInfo) resolvePackages(logical []string) []string {
+	resolved := make([]string, len(logical))
+	for i, pkg := range logical {
+		resolved[i] = o.ResolvePackage(pkg)
+	}
+	return resolved
+}
@@ -0,0 +1,405 @@
+package osdetect
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotInstalled is returned when querying a package that is not installed.
+var ErrNotInstalled = errors.New("package is not installed")
+
+// PackageManager installs, removes and queries packages using a
+// distribution's native package tool. Detect returns the backend matching
+// the host; callers may also supply their own implementation.
+type PackageManager interface {
+	// Name returns the backend name, e.g. "apt" or "dnf".
+	Name() string
+	// Install installs the given packages.
+	Install(ctx context.Context, pkgs ...string) error
+	// Remove uninstalls the given packages.
+	Remove(ctx context.Context, pkgs ...string) error
+	// IsInstalled reports whether pkg is installed.
+	IsInstalled(ctx context.Context, pkg string) (bool, error)
+	// InstalledVersion returns the installed version of pkg, or ErrNotInstalled.
+	InstalledVersion(ctx context.Context, pkg string) (string, error)
+	// RefreshIndex updates the package index from the configured repositories.
+	RefreshIndex(ctx context.Context) error
+	// Search returns the names of available packages matching query.
+	Search(ctx context.Context, query string) ([]string, error)
+}
+
+// NewPackageManager returns the built-in backend for the host with the
+// given name: "apt", "dnf", "yum", "pacman", "zypper" or "apk". Commands
+// are executed with runner, or ExecRunner if runner is nil.
+func NewPackageManager(name string, runner Runner) (PackageManager, error) {
+	d := NewRootDetector("/")
+	d.Runner = runner
+	return d.NewPackageManager(name)
+}
+
+// NewPackageManager returns the built-in backend with the given name,
+// running commands with the detector's Runner and writing beneath its Root.
+func (d *Detector) NewPackageManager(name string) (PackageManager, error) {
+	b := pkgBase{d: d}
+
+	switch name {
+	case "apt":
+		return aptManager{b}, nil
+	case "dnf", "yum":
+		return rpmManager{pkgBase: b, cmd: name}, nil
+	case "pacman":
+		return pacmanManager{b}, nil
+	case "zypper":
+		return zypperManager{b}, nil
+	case "apk":
+		return apkManager{b}, nil
+	}
+	return nil, fmt.Errorf("unsupported package manager '%s'", name)
+}
+
+// aptManager manages packages on Debian-based systems.
+type aptManager struct{ pkgBase }
+
+func (aptManager) Name() string   { return "apt" }
+func (aptManager) String() string { return "apt" }
+
+func (m aptManager) Install(ctx context.Context, pkgs ...string) error {
+	return m.run(ctx, aptEnv, "apt-get", append([]string{"install", "-y"}, pkgs...)...)
+}
+
+func (m aptManager) Remove(ctx context.Context, pkgs ...string) error {
+	return m.run(ctx, aptEnv, "apt-get", append([]string{"remove", "-y"}, pkgs...)...)
+}
+
+func (m aptManager) IsInstalled(ctx context.Context, pkg string) (bool, error) {
+	return isInstalled(ctx, m, pkg)
+}
+
+func (m aptManager) InstalledVersion(ctx context.Context, pkg string) (string, error) {
+	out, err := m.output(ctx, "dpkg-query", "-W", "-f=${db:Status-Abbrev}\t${Version}", pkg)
+	if isExitError(err) {
+		return "", ErrNotInstalled
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Status "ii" means desired=install, status=installed
+	status, version, _ := strings.Cut(out, "\t")
+	if !strings.HasPrefix(status, "ii") {
+		return "", ErrNotInstalled
+	}
+	return strings.TrimSpace(version), nil
+}
+
+func (m aptManager) RefreshIndex(ctx context.Context) error {
+	return m.run(ctx, aptEnv, "apt-get", "update", "-qq")
+}
+
+func (m aptManager) Search(ctx context.Context, query string) ([]string, error) {
+	out, err := m.output(ctx, "apt-cache", "search", "--names-only", query)
+	if err != nil {
+		return nil, err
+	}
+	return parseLines(out, func(line string) string {
+		name, _, _ := strings.Cut(line, " - ")
+		return name
+	}), nil
+}
+
+// aptEnv keeps apt from prompting for configuration.
+var aptEnv = []string{"DEBIAN_FRONTEND=noninteractive"}
+
+// rpmManager manages packages with dnf or yum.
+type rpmManager struct {
+	pkgBase
+	cmd string // "dnf" or "yum"
+}
+
+func (m rpmManager) Name() string   { return m.cmd }
+func (m rpmManager) String() string { return m.cmd }
+
+func (m rpmManager) Install(ctx context.Context, pkgs ...string) error {
+	return m.run(ctx, nil, m.cmd, append([]string{"install", "-y"}, pkgs...)...)
+}
+
+func (m rpmManager) Remove(ctx context.Context, pkgs ...string) error {
+	return m.run(ctx, nil, m.cmd, append([]string{"remove", "-y"}, pkgs...)...)
+}
+
+func (m rpmManager) IsInstalled(ctx context.Context, pkg string) (bool, error) {
+	return isInstalled(ctx, m, pkg)
+}
+
+func (m rpmManager) InstalledVersion(ctx context.Context, pkg string) (string, error) {
+	return m.rpmInstalledVersion(ctx, pkg)
+}
+
+func (m rpmManager) RefreshIndex(ctx context.Context) error {
+	return m.run(ctx, nil, m.cmd, "makecache", "-q")
+}
+
+func (m rpmManager) Search(ctx context.Context, query string) ([]string, error) {
+	out, err := m.output(ctx, m.cmd, "search", "-q", query)
+	if err != nil {
+		return nil, err
+	}
+	return parseLines(out, func(line string) string {
+		// Skip section headers such as "=== Name Matched: x ===" (dnf4)
+		// and "Matched fields: name" (dnf5)
+		if strings.HasPrefix(line, "=") || strings.HasSuffix(line, ":") || strings.HasPrefix(line, "Matched fields") {
+			return ""
+		}
+		name := strings.TrimSuffix(strings.Fields(line)[0], ":")
+		// Strip the trailing ".arch"
+		if i := strings.LastIndexByte(name, '.'); i > 0 {
+			name = name[:i]
+		}
+		return name
+	}), nil
+}
+
+// pacmanManager manages packages on Arch-based systems.
+type pacmanManager struct{ pkgBase }
+
+func (pacmanManager) Name() string   { return "pacman" }
+func (pacmanManager) String() string { return "pacman" }
+
+func (m pacmanManager) Install(ctx context.Context, pkgs ...string) error {
+	return m.run(ctx, nil, "pacman", append([]string{"-S", "--noconfirm", "--needed"}, pkgs...)...)
+}
+
+func (m pacmanManager) Remove(ctx context.Context, pkgs ...string) error {
+	return m.run(ctx, nil, "pacman", append([]string{"-R", "--noconfirm"}, pkgs...)...)
+}
+
+func (m pacmanManager) IsInstalled(ctx context.Context, pkg string) (bool, error) {
+	return isInstalled(ctx, m, pkg)
+}
+
+func (m pacmanManager) InstalledVersion(ctx context.Context, pkg string) (string, error) {
+	out, err := m.output(ctx, "pacman", "-Q", pkg)
+	if isExitError(err) {
+		return "", ErrNotInstalled
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Output is "name version"
+	fields := strings.Fields(out)
+	if len(fields) < 2 {
+		return "", ErrNotInstalled
+	}
+	return fields[1], nil
+}
+
+func (m pacmanManager) RefreshIndex(ctx context.Context) error {
+	return m.run(ctx, nil, "pacman", "-Sy", "--noconfirm")
+}
+
+func (m pacmanManager) Search(ctx context.Context, query string) ([]string, error) {
+	out, err := m.output(ctx, "pacman", "-Ssq", query)
+	if isExitError(err) {
+		return nil, nil // pacman exits 1 when nothing matches
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseLines(out, nil), nil
+}
+
+// zypperManager manages packages on openSUSE and SLES.
+type zypperManager struct{ pkgBase }
+
+func (zypperManager) Name() string   { return "zypper" }
+func (zypperManager) String() string { return "zypper" }
+
+func (m zypperManager) Install(ctx context.Context, pkgs ...string) error {
+	return m.run(ctx, nil, "zypper", append([]string{"--non-interactive", "install"}, pkgs...)...)
+}
+
+func (m zypperManager) Remove(ctx context.Context, pkgs ...string) error {
+	return m.run(ctx, nil, "zypper", append([]string{"--non-interactive", "remove"}, pkgs...)...)
+}
+
+func (m zypperManager) IsInstalled(ctx context.Context, pkg string) (bool, error) {
+	return isInstalled(ctx, m, pkg)
+}
+
+func (m zypperManager) InstalledVersion(ctx context.Context, pkg string) (string, error) {
+	return m.rpmInstalledVersion(ctx, pkg)
+}
+
+func (m zypperManager) RefreshIndex(ctx context.Context) error {
+	return m.run(ctx, nil, "zypper", "--non-interactive", "refresh")
+}
+
+func (m zypperManager) Search(ctx context.Context, query string) ([]string, error) {
+	out, err := m.output(ctx, "zypper", "--non-interactive", "--quiet", "search", "-t", "package", query)
+	if isExitError(err) {
+		return nil, nil // zypper exits 104 when nothing matches
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Output is a table: "S | Name | Summary | Type"
+	return parseLines(out, func(line string) string {
+		cols := strings.Split(line, "|")
+		if len(cols) < 2 {
+			return ""
+		}
+		name := strings.TrimSpace(cols[1])
+		if name == "Name" || strings.HasPrefix(line, "--") {
+			return ""
+		}
+		return name
+	}), nil
+}
+
+// apkManager manages packages on Alpine.
+type apkManager struct{ pkgBase }
+
+func (apkManager) Name() string   { return "apk" }
+func (apkManager) String() string { return "apk" }
+
+func (m apkManager) Install(ctx context.Context, pkgs ...string) error {
+	return m.run(ctx, nil, "apk", append([]string{"add"}, pkgs...)...)
+}
+
+func (m apkManager) Remove(ctx context.Context, pkgs ...string) error {
+	return m.run(ctx, nil, "apk", append([]string{"del"}, pkgs...)...)
+}
+
+func (m apkManager) IsInstalled(ctx context.Context, pkg string) (bool, error) {
+	// "apk info -e" exits non-zero unless pkg is installed
+	out, err := m.output(ctx, "apk", "info", "-e", pkg)
+	if isExitError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == pkg, nil
+}
+
+func (m apkManager) InstalledVersion(ctx context.Context, pkg string) (string, error) {
+	out, err := m.output(ctx, "apk", "list", "--installed", pkg)
+	if err != nil {
+		return "", err
+	}
+
+	// Output is "name-version-rN arch {origin} (license) [installed]"
+	for _, line := range parseLines(out, nil) {
+		name, version := splitAPKName(strings.Fields(line)[0])
+		if name == pkg {
+			return version, nil
+		}
+	}
+	return "", ErrNotInstalled
+}
+
+func (m apkManager) RefreshIndex(ctx context.Context) error {
+	return m.run(ctx, nil, "apk", "update", "-q")
+}
+
+func (m apkManager) Search(ctx context.Context, query string) ([]string, error) {
+	out, err := m.output(ctx, "apk", "search", query)
+	if err != nil {
+		return nil, err
+	}
+	return parseLines(out, func(line string) string {
+		name, _ := splitAPKName(line)
+		return name
+	}), nil
+}
+
+// splitAPKName splits "name-1.2.3-r0" into its name and version.
+func splitAPKName(s string) (name, version string) {
+	// The version is the last two dash-separated fields: "1.2.3" and "r0"
+	i := strings.LastIndexByte(s, '-')
+	if i <= 0 {
+		return s, ""
+	}
+	j := strings.LastIndexByte(s[:i], '-')
+	if j <= 0 {
+		return s, ""
+	}
+	return s[:j], s[j+1:]
+}
+
+// rpmInstalledVersion queries the rpm database for the installed version of pkg.
+func (b pkgBase) rpmInstalledVersion(ctx context.Context, pkg string) (string, error) {
+	out, err := b.output(ctx, "rpm", "-q", "--qf", "%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\n", pkg)
+	if isExitError(err) {
+		return "", ErrNotInstalled
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Multiple versions may be installed (e.g. kernel); report the last one
+	lines := parseLines(out, nil)
+	if len(lines) == 0 {
+		return "", ErrNotInstalled
+	}
+	return lines[len(lines)-1], nil
+}
+
+// isInstalled implements IsInstalled on top of InstalledVersion.
+func isInstalled(ctx context.Context, m PackageManager, pkg string) (bool, error) {
+	_, err := m.InstalledVersion(ctx, pkg)
+	if errors.Is(err, ErrNotInstalled) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// parseLines splits command output into trimmed, non-empty lines, optionally
+// mapping each through fn. Lines mapped to "" are dropped.
+func parseLines(out string, fn func(string) string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if fn != nil {
+			line = fn(line)
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// pkgBase holds state shared by the built-in backends.
+type pkgBase struct {
+	d *Detector
+}
+
+// run runs a command, capturing its output. Failures are reported as *ExitError.
+func (b pkgBase) run(ctx context.Context, env []string, name string, args ...string) error {
+	_, err := b.d.runner().Run(ctx, Cmd{Name: name, Args: args, Env: env})
+	return err
+}
+
+// output runs a command and returns its standard output.
+func (b pkgBase) output(ctx context.Context, name string, args ...string) (string, error) {
+	res, err := b.d.runner().Run(ctx, Query(name, args...))
+	if res == nil {
+		return "", err
+	}
+	return string(res.Stdout), err
+}
+
+// isExitError reports whether err is a non-zero exit status from a command that ran.
+func isExitError(err error) bool {
+	var exitErr *ExitError
+	return errors.As(err, &exitErr)
+}
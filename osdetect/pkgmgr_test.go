@@ -0,0 +1,332 @@
+package osdetect
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPackageManagerCommands(t *testing.T) {
+	tests := []struct {
+		pm         string
+		searchOut  string
+		wantSearch []string
+		want       []string
+	}{
+		{
+			pm:         "apt",
+			searchOut:  "bind9 - Internet Domain Name Server\nbind9-dnsutils - Clients provided with BIND 9\n",
+			wantSearch: []string{"bind9", "bind9-dnsutils"},
+			want: []string{
+				"DEBIAN_FRONTEND=noninteractive apt-get remove -y bind",
+				"DEBIAN_FRONTEND=noninteractive apt-get update -qq",
+				"apt-cache search --names-only bind",
+			},
+		},
+		{
+			pm:         "dnf",
+			searchOut:  "=== Name Matched: bind ===\nbind.x86_64 : The Berkeley Internet Name Domain (BIND) DNS server\nbind-utils.x86_64 : Utilities for querying DNS name servers\n",
+			wantSearch: []string{"bind", "bind-utils"},
+			want: []string{
+				"dnf remove -y bind",
+				"dnf makecache -q",
+				"dnf search -q bind",
+			},
+		},
+		{
+			pm:         "yum",
+			searchOut:  "Matched fields: name\nbind.aarch64\tThe Berkeley Internet Name Domain (BIND) DNS server\n",
+			wantSearch: []string{"bind"},
+			want: []string{
+				"yum remove -y bind",
+				"yum makecache -q",
+				"yum search -q bind",
+			},
+		},
+		{
+			pm:         "pacman",
+			searchOut:  "bind\nbind-tools\n",
+			wantSearch: []string{"bind", "bind-tools"},
+			want: []string{
+				"pacman -R --noconfirm bind",
+				"pacman -Sy --noconfirm",
+				"pacman -Ssq bind",
+			},
+		},
+		{
+			pm: "zypper",
+			searchOut: "S | Name       | Summary                  | Type\n" +
+				"--+------------+--------------------------+--------\n" +
+				"  | bind       | Domain Name System (DNS) | package\n" +
+				"i | bind-utils | Utilities to query DNS   | package\n",
+			wantSearch: []string{"bind", "bind-utils"},
+			want: []string{
+				"zypper --non-interactive remove bind",
+				"zypper --non-interactive refresh",
+				"zypper --non-interactive --quiet search -t package bind",
+			},
+		},
+		{
+			pm:         "apk",
+			searchOut:  "bind-9.18.24-r0\nbind-tools-9.18.24-r0\n",
+			wantSearch: []string{"bind", "bind-tools"},
+			want: []string{
+				"apk del bind",
+				"apk update -q",
+				"apk search bind",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pm, func(t *testing.T) {
+			r := &RecordingRunner{Handler: func(Cmd) (*Result, error) {
+				return &Result{Stdout: []byte(tt.searchOut)}, nil
+			}}
+			d := NewDetector(fstest.MapFS{})
+			d.Runner = r
+			pm, err := d.NewPackageManager(tt.pm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pm.Name() != tt.pm {
+				t.Errorf("Name() = %q, want %q", pm.Name(), tt.pm)
+			}
+
+			ctx := context.Background()
+			if err := pm.Remove(ctx, "bind"); err != nil {
+				t.Fatal(err)
+			}
+			if err := pm.RefreshIndex(ctx); err != nil {
+				t.Fatal(err)
+			}
+			found, err := pm.Search(ctx, "bind")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(found, tt.wantSearch) {
+				t.Errorf("Search() = %q, want %q", found, tt.wantSearch)
+			}
+			if got := r.CommandLines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchNoMatches(t *testing.T) {
+	for _, name := range []string{"pacman", "zypper"} {
+		d := NewDetector(fstest.MapFS{})
+		d.Runner = &RecordingRunner{Handler: func(Cmd) (*Result, error) {
+			return &Result{ExitCode: 104}, nil
+		}}
+		pm, err := d.NewPackageManager(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found, err := pm.Search(context.Background(), "nope"); err != nil || len(found) != 0 {
+			t.Errorf("%s: Search() = %q, %v, want no matches", name, found, err)
+		}
+	}
+}
+
+func TestNewPackageManagerUnsupported(t *testing.T) {
+	if _, err := NewDetector(fstest.MapFS{}).NewPackageManager("emerge"); err == nil {
+		t.Error("NewPackageManager accepted an unknown backend")
+	}
+}
+
+// notInstalled fails every package query as if nothing were installed.
+func notInstalled(cmd Cmd) (*Result, error) {
+	switch cmd.Name {
+	case "dpkg-query", "rpm":
+		return &Result{ExitCode: 1}, nil
+	case "pacman", "apk":
+		if cmd.Args[0] == "-Q" || cmd.Args[0] == "info" || cmd.Args[0] == "list" {
+			return &Result{ExitCode: 1}, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestInstallPackagesCommands(t *testing.T) {
+	tests := []struct {
+		pm   string
+		want []string
+	}{
+		{"apt", []string{
+			"dpkg-query -W '-f=${db:Status-Abbrev}\t${Version}' dnsutils",
+			"DEBIAN_FRONTEND=noninteractive apt-get update -qq",
+			"DEBIAN_FRONTEND=noninteractive apt-get install -y dnsutils",
+		}},
+		{"dnf", []string{
+			"rpm -q --qf '%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\n' bind-utils",
+			"dnf install -y bind-utils",
+		}},
+		{"yum", []string{
+			"rpm -q --qf '%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\n' bind-utils",
+			"yum install -y bind-utils",
+		}},
+		// pacman -Sy before -S would be a partial upgrade
+		{"pacman", []string{
+			"pacman -Q bind",
+			"pacman -S --noconfirm --needed bind",
+		}},
+		{"zypper", []string{
+			"rpm -q --qf '%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\n' bind-utils",
+			"zypper --non-interactive install bind-utils",
+		}},
+		{"apk", []string{
+			"apk info -e bind-tools",
+			"apk update -q",
+			"apk add bind-tools",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pm, func(t *testing.T) {
+			r := &RecordingRunner{Handler: notInstalled}
+			d := NewDetector(fstest.MapFS{})
+			d.Runner = r
+			pm, err := d.NewPackageManager(tt.pm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			invalidateIndex(pm)
+			t.Cleanup(func() { invalidateIndex(pm) })
+
+			info := &OSInfo{ID: "test", PackageManager: pm}
+			if err := info.InstallPackages(context.Background(), "dnsutils"); err != nil {
+				t.Fatal(err)
+			}
+			if got := r.CommandLines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands =\n%q\nwant\n%q", got, tt.want)
+			}
+
+			// The index is refreshed at most once per process
+			r.Reset()
+			if err := info.InstallPackages(context.Background(), "dnsutils"); err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range r.CommandLines() {
+				if line == "DEBIAN_FRONTEND=noninteractive apt-get update -qq" || line == "apk update -q" {
+					t.Errorf("index refreshed again: %s", line)
+				}
+			}
+		})
+	}
+}
+
+func TestInstallPackagesSkipsInstalled(t *testing.T) {
+	r := &RecordingRunner{Handler: func(cmd Cmd) (*Result, error) {
+		return &Result{Stdout: []byte("ii \t1:9.18.24-1")}, nil
+	}}
+	d := NewDetector(fstest.MapFS{})
+	d.Runner = r
+	pm, err := d.NewPackageManager("apt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := &OSInfo{ID: "debian", PackageManager: pm}
+	if err := info.InstallPackages(context.Background(), "dnsutils"); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.CommandLines(); len(got) != 1 {
+		t.Errorf("commands = %q, want only the dpkg-query", got)
+	}
+}
+
+func TestInstallPackagesFailure(t *testing.T) {
+	r := &RecordingRunner{Handler: func(cmd Cmd) (*Result, error) {
+		if cmd.Name == "dnf" {
+			return &Result{ExitCode: 1, Stderr: []byte("Error: Unable to find a match: nope")}, nil
+		}
+		return notInstalled(cmd)
+	}}
+	d := NewDetector(fstest.MapFS{})
+	d.Runner = r
+	pm, err := d.NewPackageManager("dnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = (&OSInfo{ID: "fedora", PackageManager: pm}).InstallPackages(context.Background(), "nope")
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 1 {
+		t.Fatalf("InstallPackages error = %v, want *ExitError", err)
+	}
+}
+
+func TestInstalledVersionParsing(t *testing.T) {
+	tests := []struct {
+		pm     string
+		stdout string
+		want   string
+	}{
+		{"apt", "ii \t2.4.1-1", "2.4.1-1"},
+		{"apt", "rc \t2.4.1-1", ""},
+		{"dnf", "1.2-1\n1.3-1\n", "1.3-1"},
+		{"pacman", "bind 9.18.24-1\n", "9.18.24-1"},
+		{"apk", "bind-tools-9.18.24-r0 x86_64 {bind} (MPL-2.0) [installed]\n", "9.18.24-r0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pm+" "+tt.want, func(t *testing.T) {
+			d := NewDetector(fstest.MapFS{})
+			d.Runner = &RecordingRunner{Handler: func(Cmd) (*Result, error) {
+				return &Result{Stdout: []byte(tt.stdout)}, nil
+			}}
+			pm, err := d.NewPackageManager(tt.pm)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pkg := map[string]string{"apk": "bind-tools"}[tt.pm]
+			if pkg == "" {
+				pkg = "bind"
+			}
+			got, err := pm.InstalledVersion(context.Background(), pkg)
+			if tt.want == "" {
+				if !errors.Is(err, ErrNotInstalled) {
+					t.Errorf("InstalledVersion = %q, %v, want ErrNotInstalled", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("InstalledVersion = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireVersion(t *testing.T) {
+	tests := []struct {
+		installed string
+		min       string
+		wantErr   bool
+	}{
+		{"1.2-1", "1.2", false},
+		{"1.2-1", "1.2-1", false},
+		{"1.2-1", "1.2-2", true},
+		{"1:1.0-1", "2.0", false},
+		{"1.1-5", "1.2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.installed+" >= "+tt.min, func(t *testing.T) {
+			d := NewDetector(fstest.MapFS{})
+			d.Runner = &RecordingRunner{Handler: func(Cmd) (*Result, error) {
+				return &Result{Stdout: []byte("ii \t" + tt.installed)}, nil
+			}}
+			pm, err := d.NewPackageManager("apt")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = (&OSInfo{ID: "debian", PackageManager: pm}).RequireVersion(context.Background(), "bind9", tt.min)
+			var versionErr *VersionError
+			if tt.wantErr != errors.As(err, &versionErr) {
+				t.Errorf("RequireVersion() error = %v, want VersionError %v", err, tt.wantErr)
+			}
+		})
+	}
+}
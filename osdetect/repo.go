@@ -0,0 +1,396 @@
+package osdetect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Repository describes a third-party package repository.
+type Repository struct {
+	Name    string // Identifier used in file names, e.g., "myapp"
+	URL     string // Base URL of the repository
+	KeyFile string // Local path to the signing key, ASCII-armored or binary
+
+	// Suite and Components apply to apt. Suite defaults to the release
+	// codename and Components to "main".
+	Suite      string
+	Components []string
+
+	Description string // Display name for rpm repositories; defaults to Name
+
+	// ConfigFile is a local repository definition (.list or .sources for
+	// apt, .repo for dnf, yum and zypper) installed verbatim instead of
+	// one generated from URL.
+	ConfigFile string
+}
+
+// RepositoryManager is implemented by package managers that can add and
+// remove third-party repositories. All built-in backends except pacman
+// implement it.
+type RepositoryManager interface {
+	// AddRepository installs the repository and its signing key.
+	// Adding a repository that is already configured is a no-op.
+	AddRepository(ctx context.Context, repo Repository) error
+	// RemoveRepository removes the files AddRepository installed for
+	// the same repo. Files that have since been changed are kept.
+	RemoveRepository(ctx context.Context, repo Repository) error
+}
+
+var repoNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// validate checks that repo can be installed.
+func (r Repository) validate() error {
+	if !repoNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("invalid repository name '%s'", r.Name)
+	}
+	if r.ConfigFile == "" {
+		if r.URL == "" {
+			return fmt.Errorf("repository '%s' has no URL", r.Name)
+		}
+		if r.KeyFile == "" {
+			return fmt.Errorf("repository '%s' has no signing key", r.Name)
+		}
+	}
+	return nil
+}
+
+// AddRepository adds a third-party repository using the detected package
+// manager. The package index is refreshed on the next InstallPackages call.
+func (o *OSInfo) AddRepository(ctx context.Context, repo Repository) error {
+	rm, err := o.repositoryManager()
+	if err != nil {
+		return err
+	}
+	if err := repo.validate(); err != nil {
+		return err
+	}
+	if repo.Suite == "" {
+		repo.Suite = o.VersionCodename
+	}
+
+	if err := rm.AddRepository(ctx, repo); err != nil {
+		return fmt.Errorf("failed to add repository '%s': %w", repo.Name, err)
+	}
+	invalidateIndex(o.PackageManager)
+	return nil
+}
+
+// RemoveRepository removes a repository added with AddRepository, which
+// must be passed the same repo.
+func (o *OSInfo) RemoveRepository(ctx context.Context, repo Repository) error {
+	rm, err := o.repositoryManager()
+	if err != nil {
+		return err
+	}
+	if !repoNamePattern.MatchString(repo.Name) {
+		return fmt.Errorf("invalid repository name '%s'", repo.Name)
+	}
+	if repo.Suite == "" {
+		repo.Suite = o.VersionCodename
+	}
+
+	if err := rm.RemoveRepository(ctx, repo); err != nil {
+		return fmt.Errorf("failed to remove repository '%s': %w", repo.Name, err)
+	}
+	invalidateIndex(o.PackageManager)
+	return nil
+}
+
+// repositoryManager returns the detected package manager as a RepositoryManager.
+func (o *OSInfo) repositoryManager() (RepositoryManager, error) {
+	if o.PackageManager == nil {
+		return nil, fmt.Errorf("could not detect package manager for OS '%s'", o.ID)
+	}
+	rm, ok := o.PackageManager.(RepositoryManager)
+	if !ok {
+		return nil, fmt.Errorf("%s does not support repository management", o.PackageManager.Name())
+	}
+	return rm, nil
+}
+
+const (
+	aptKeyringDir = "/etc/apt/keyrings"
+	aptSourcesDir = "/etc/apt/sources.list.d"
+)
+
+func (m aptManager) AddRepository(_ context.Context, repo Repository) error {
+	files, err := m.repoFiles(repo)
+	if err != nil {
+		return err
+	}
+	return m.writeFiles(files)
+}
+
+func (m aptManager) RemoveRepository(_ context.Context, repo Repository) error {
+	files, err := m.repoFiles(repo)
+	if err != nil {
+		return err
+	}
+	return m.removeFiles(files)
+}
+
+// repoFiles returns the keyring and sources file for repo.
+func (m aptManager) repoFiles(repo Repository) ([]repoFile, error) {
+	var files []repoFile
+	var keyPath string
+	if repo.KeyFile != "" {
+		key, err := os.ReadFile(repo.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// apt accepts armored keys only with an .asc extension
+		keyPath = path.Join(aptKeyringDir, repo.Name+".gpg")
+		if isArmoredKey(key) {
+			keyPath = path.Join(aptKeyringDir, repo.Name+".asc")
+		}
+		files = append(files, repoFile{keyPath, key})
+	}
+
+	if repo.ConfigFile != "" {
+		ext := filepath.Ext(repo.ConfigFile)
+		if ext != ".list" && ext != ".sources" {
+			return nil, fmt.Errorf("apt repository file must end in .list or .sources: %s", repo.ConfigFile)
+		}
+		data, err := os.ReadFile(repo.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		return append(files, repoFile{path.Join(aptSourcesDir, repo.Name+ext), data}), nil
+	}
+
+	if repo.Suite == "" {
+		return nil, errors.New("apt repository requires a suite")
+	}
+	components := repo.Components
+	if len(components) == 0 {
+		components = []string{"main"}
+	}
+
+	line := fmt.Sprintf("deb [signed-by=%s] %s %s %s\n", keyPath, repo.URL, repo.Suite, strings.Join(components, " "))
+	return append(files, repoFile{path.Join(aptSourcesDir, repo.Name+".list"), []byte(line)}), nil
+}
+
+// isArmoredKey reports whether key is an ASCII-armored OpenPGP key.
+func isArmoredKey(key []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN PGP"))
+}
+
+const rpmKeyDir = "/etc/pki/rpm-gpg"
+
+func (m rpmManager) AddRepository(_ context.Context, repo Repository) error {
+	files, _, err := m.rpmRepoFiles("/etc/yum.repos.d", repo, "")
+	if err != nil {
+		return err
+	}
+	return m.writeFiles(files)
+}
+
+// RemoveRepository removes the repository files. Keys already imported
+// into the rpm database are left in place.
+func (m rpmManager) RemoveRepository(_ context.Context, repo Repository) error {
+	files, _, err := m.rpmRepoFiles("/etc/yum.repos.d", repo, "")
+	if err != nil {
+		return err
+	}
+	return m.removeFiles(files)
+}
+
+const (
+	zypperRepoDir   = "/etc/zypp/repos.d"
+	zypperRepoExtra = "autorefresh=1\ntype=rpm-md\n"
+)
+
+func (m zypperManager) AddRepository(ctx context.Context, repo Repository) error {
+	files, keyPath, err := m.rpmRepoFiles(zypperRepoDir, repo, zypperRepoExtra)
+	if err != nil {
+		return err
+	}
+	if err := m.writeFiles(files); err != nil || keyPath == "" {
+		return err
+	}
+
+	// zypper refuses unknown keys in non-interactive mode, so trust ours up front
+	hostKey, err := m.d.hostPath(keyPath)
+	if err != nil {
+		return err
+	}
+	args := []string{"--import", hostKey}
+	if m.d.Root != "/" {
+		args = append([]string{"--root", m.d.Root}, args...)
+	}
+	return m.run(ctx, nil, "rpm", args...)
+}
+
+// RemoveRepository removes the repository files. Keys already imported
+// into the rpm database are left in place.
+func (m zypperManager) RemoveRepository(_ context.Context, repo Repository) error {
+	files, _, err := m.rpmRepoFiles(zypperRepoDir, repo, zypperRepoExtra)
+	if err != nil {
+		return err
+	}
+	return m.removeFiles(files)
+}
+
+// rpmRepoFiles returns repo's key and .repo file in repoDir, appending
+// extra to generated definitions, and the key's path, if any.
+func (b pkgBase) rpmRepoFiles(repoDir string, repo Repository, extra string) ([]repoFile, string, error) {
+	var files []repoFile
+	var keyPath string
+	if repo.KeyFile != "" {
+		key, err := os.ReadFile(repo.KeyFile)
+		if err != nil {
+			return nil, "", err
+		}
+		keyPath = path.Join(rpmKeyDir, "RPM-GPG-KEY-"+repo.Name)
+		files = append(files, repoFile{keyPath, key})
+	}
+
+	repoPath := path.Join(repoDir, repo.Name+".repo")
+	if repo.ConfigFile != "" {
+		data, err := os.ReadFile(repo.ConfigFile)
+		if err != nil {
+			return nil, "", err
+		}
+		return append(files, repoFile{repoPath, data}), keyPath, nil
+	}
+
+	description := repo.Description
+	if description == "" {
+		description = repo.Name
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "[%s]\n", repo.Name)
+	fmt.Fprintf(&buf, "name=%s\n", description)
+	fmt.Fprintf(&buf, "baseurl=%s\n", repo.URL)
+	buf.WriteString("enabled=1\n")
+	buf.WriteString("gpgcheck=1\n")
+	fmt.Fprintf(&buf, "gpgkey=file://%s\n", keyPath)
+	buf.WriteString(extra)
+	return append(files, repoFile{repoPath, []byte(buf.String())}), keyPath, nil
+}
+
+const (
+	apkRepositoriesFile = "/etc/apk/repositories"
+	apkKeyDir           = "/etc/apk/keys"
+)
+
+func (m apkManager) AddRepository(_ context.Context, repo Repository) error {
+	if repo.ConfigFile != "" {
+		return errors.New("apk does not support repository config files")
+	}
+
+	// apk matches keys by file name, so the original name must be kept
+	key, err := os.ReadFile(repo.KeyFile)
+	if err != nil {
+		return err
+	}
+	if _, err := m.d.writeFile(path.Join(apkKeyDir, filepath.Base(repo.KeyFile)), key, 0644); err != nil {
+		return err
+	}
+
+	lines, err := m.apkRepositories()
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == repo.URL {
+			return nil
+		}
+	}
+
+	lines = append(lines, repo.URL)
+	_, err = m.d.writeFile(apkRepositoriesFile, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	return err
+}
+
+func (m apkManager) RemoveRepository(_ context.Context, repo Repository) error {
+	if repo.KeyFile != "" {
+		key, err := os.ReadFile(repo.KeyFile)
+		if err != nil {
+			return err
+		}
+		if err := m.removeFiles([]repoFile{{path.Join(apkKeyDir, filepath.Base(repo.KeyFile)), key}}); err != nil {
+			return err
+		}
+	}
+	if repo.URL == "" {
+		return nil
+	}
+
+	lines, err := m.apkRepositories()
+	if err != nil {
+		return err
+	}
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.TrimSpace(line) != repo.URL {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == len(lines) {
+		return nil
+	}
+
+	_, err = m.d.writeFile(apkRepositoriesFile, []byte(strings.Join(kept, "\n")+"\n"), 0644)
+	return err
+}
+
+// apkRepositories returns the lines of /etc/apk/repositories.
+func (m apkManager) apkRepositories() ([]string, error) {
+	data, err := m.d.readFile(apkRepositoriesFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	content := strings.TrimRight(string(data), "\n")
+	if content == "" {
+		return nil, nil
+	}
+	return strings.Split(content, "\n"), nil
+}
+
+// repoFile is a file installed by AddRepository.
+type repoFile struct {
+	path string
+	data []byte
+}
+
+// writeFiles installs files beneath the detector's Root.
+func (b pkgBase) writeFiles(files []repoFile) error {
+	for _, f := range files {
+		if _, err := b.d.writeFile(f.path, f.data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFiles removes each of files that still holds the data written by
+// AddRepository, leaving missing and changed files alone.
+func (b pkgBase) removeFiles(files []repoFile) error {
+	for _, f := range files {
+		current, err := b.d.readFile(f.path)
+		if errors.Is(err, fs.ErrNotExist) || (err == nil && !bytes.Equal(current, f.data)) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := b.d.removeFile(f.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package osdetect
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readTree returns the contents of every regular file beneath root by
+// slash-separated relative path.
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, name)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestRepositoryFiles(t *testing.T) {
+	const (
+		armoredKey = "-----BEGIN PGP PUBLIC KEY BLOCK-----\nmDMEZ...\n-----END PGP PUBLIC KEY BLOCK-----\n"
+		binaryKey  = "\x99\x01\x0d\x04binary"
+	)
+	tests := []struct {
+		name    string
+		pm      string
+		key     string // Contents of the local key file, if any
+		keyName string
+		config  string // Contents of the local config file, if any
+		ext     string
+		foreign map[string]string // Files that exist before AddRepository
+		want    map[string]string // Files written by AddRepository
+		cmds    func(root string) []string
+	}{
+		{
+			name:    "apt list",
+			pm:      "apt",
+			key:     armoredKey,
+			keyName: "myapp.asc",
+			// The distribution's own sources must survive RemoveRepository
+			foreign: map[string]string{"etc/apt/sources.list.d/myapp.sources": "Types: deb\n"},
+			want: map[string]string{
+				"etc/apt/keyrings/myapp.asc":        armoredKey,
+				"etc/apt/sources.list.d/myapp.list": "deb [signed-by=/etc/apt/keyrings/myapp.asc] https://pkg.example.com/repo bookworm main\n",
+			},
+		},
+		{
+			name:    "apt sources",
+			pm:      "apt",
+			key:     binaryKey,
+			keyName: "myapp.gpg",
+			config:  "Types: deb\nURIs: https://pkg.example.com/repo\nSuites: stable\nComponents: main\nSigned-By: /etc/apt/keyrings/myapp.gpg\n",
+			ext:     ".sources",
+			foreign: map[string]string{"etc/apt/keyrings/myapp.asc": "someone else's key\n"},
+			want: map[string]string{
+				"etc/apt/keyrings/myapp.gpg":           binaryKey,
+				"etc/apt/sources.list.d/myapp.sources": "Types: deb\nURIs: https://pkg.example.com/repo\nSuites: stable\nComponents: main\nSigned-By: /etc/apt/keyrings/myapp.gpg\n",
+			},
+		},
+		{
+			name:    "yum",
+			pm:      "yum",
+			key:     armoredKey,
+			keyName: "myapp.asc",
+			want: map[string]string{
+				"etc/pki/rpm-gpg/RPM-GPG-KEY-myapp": armoredKey,
+				"etc/yum.repos.d/myapp.repo": "[myapp]\nname=My App\nbaseurl=https://pkg.example.com/repo\n" +
+					"enabled=1\ngpgcheck=1\ngpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-myapp\n",
+			},
+		},
+		{
+			name:    "zypper",
+			pm:      "zypper",
+			key:     armoredKey,
+			keyName: "myapp.asc",
+			want: map[string]string{
+				"etc/pki/rpm-gpg/RPM-GPG-KEY-myapp": armoredKey,
+				"etc/zypp/repos.d/myapp.repo": "[myapp]\nname=My App\nbaseurl=https://pkg.example.com/repo\n" +
+					"enabled=1\ngpgcheck=1\ngpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-myapp\nautorefresh=1\ntype=rpm-md\n",
+			},
+			cmds: func(root string) []string {
+				return []string{"rpm --root " + root + " --import " + filepath.Join(root, "etc/pki/rpm-gpg/RPM-GPG-KEY-myapp")}
+			},
+		},
+		{
+			name:    "apk",
+			pm:      "apk",
+			key:     "-----BEGIN PUBLIC KEY-----\nMIIB...\n-----END PUBLIC KEY-----\n",
+			keyName: "myapp-65a0b1c2.rsa.pub",
+			foreign: map[string]string{"etc/apk/repositories": "https://dl-cdn.alpinelinux.org/alpine/v3.20/main\n"},
+			want: map[string]string{
+				"etc/apk/keys/myapp-65a0b1c2.rsa.pub": "-----BEGIN PUBLIC KEY-----\nMIIB...\n-----END PUBLIC KEY-----\n",
+				"etc/apk/repositories":                "https://dl-cdn.alpinelinux.org/alpine/v3.20/main\nhttps://pkg.example.com/repo\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, root := t.TempDir(), t.TempDir()
+			for name, content := range tt.foreign {
+				writeTestFile(t, root, name, content)
+			}
+			repo := Repository{Name: "myapp", URL: "https://pkg.example.com/repo", Description: "My App"}
+			if tt.key != "" {
+				repo.KeyFile = filepath.Join(src, tt.keyName)
+				writeTestFile(t, src, tt.keyName, tt.key)
+			}
+			if tt.config != "" {
+				repo.ConfigFile = filepath.Join(src, "myapp"+tt.ext)
+				writeTestFile(t, src, "myapp"+tt.ext, tt.config)
+			}
+
+			r := &RecordingRunner{}
+			d := NewRootDetector(root)
+			d.Runner = r
+			pm, err := d.NewPackageManager(tt.pm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info := &OSInfo{ID: "test", VersionCodename: "bookworm", PackageManager: pm}
+			ctx := context.Background()
+
+			if err := info.AddRepository(ctx, repo); err != nil {
+				t.Fatal(err)
+			}
+			want := make(map[string]string)
+			for name, content := range tt.foreign {
+				want[name] = content
+			}
+			for name, content := range tt.want {
+				want[name] = content
+			}
+			if got := readTree(t, root); !reflect.DeepEqual(got, want) {
+				t.Errorf("files after AddRepository =\n%q\nwant\n%q", got, want)
+			}
+			var wantCmds []string
+			if tt.cmds != nil {
+				wantCmds = tt.cmds(root)
+			}
+			if got := r.CommandLines(); !reflect.DeepEqual(got, wantCmds) {
+				t.Errorf("commands = %q, want %q", got, wantCmds)
+			}
+
+			// Adding again changes nothing
+			if err := info.AddRepository(ctx, repo); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTree(t, root); !reflect.DeepEqual(got, want) {
+				t.Errorf("files after second AddRepository =\n%q\nwant\n%q", got, want)
+			}
+
+			// Only the files AddRepository wrote are removed
+			if err := info.RemoveRepository(ctx, repo); err != nil {
+				t.Fatal(err)
+			}
+			wantLeft := make(map[string]string)
+			for name, content := range tt.foreign {
+				wantLeft[name] = content
+			}
+			if got := readTree(t, root); !reflect.DeepEqual(got, wantLeft) {
+				t.Errorf("files after RemoveRepository =\n%q\nwant\n%q", got, wantLeft)
+			}
+		})
+	}
+}
+
+func TestRemoveRepositoryKeepsChangedFiles(t *testing.T) {
+	src, root := t.TempDir(), t.TempDir()
+	writeTestFile(t, src, "myapp.gpg", "\x99binary")
+	repo := Repository{Name: "myapp", URL: "https://pkg.example.com/repo", KeyFile: filepath.Join(src, "myapp.gpg")}
+
+	d := NewRootDetector(root)
+	d.Runner = &RecordingRunner{}
+	pm, err := d.NewPackageManager("dnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &OSInfo{ID: "fedora", PackageManager: pm}
+	if err := info.AddRepository(context.Background(), repo); err != nil {
+		t.Fatal(err)
+	}
+
+	// The administrator disabled the repository by hand
+	edited := "[myapp]\nenabled=0\n"
+	writeTestFile(t, root, "etc/yum.repos.d/myapp.repo", edited)
+	if err := info.RemoveRepository(context.Background(), repo); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readTree(t, root), map[string]string{"etc/yum.repos.d/myapp.repo": edited}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files after RemoveRepository = %q, want %q", got, want)
+	}
+}
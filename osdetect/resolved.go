@@ -0,0 +1,299 @@
+package osdetect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	resolvConf        = "/etc/resolv.conf"
+	resolvedConfDir   = "/etc/systemd/resolved.conf.d"
+	resolvedUplinks   = "../run/systemd/resolve/resolv.conf" // Upstream servers, bypassing the stub
+	resolvConfBackup  = "/etc/resolv.conf.orig"
+	resolvedLinkLabel = "# resolv.conf: "
+)
+
+// resolvedConfDirs are searched for drop-ins, highest precedence first.
+var resolvedConfDirs = []string{
+	resolvedConfDir,
+	"/run/systemd/resolved.conf.d",
+	"/usr/local/lib/systemd/resolved.conf.d",
+	"/usr/lib/systemd/resolved.conf.d",
+}
+
+// ResolvedStatus is the state of systemd-resolved's DNS stub listener.
+type ResolvedStatus struct {
+	Active         bool   // systemd-resolved is running
+	StubListener   bool   // DNSStubListener is enabled, binding 127.0.0.53:53
+	ResolvConfLink string // Target of the /etc/resolv.conf symlink; empty for a regular file
+}
+
+// StubInUse reports whether the stub listener is running and would conflict
+// with another DNS server on port 53.
+func (s *ResolvedStatus) StubInUse() bool {
+	return s.Active && s.StubListener
+}
+
+// Resolved inspects systemd-resolved and takes over its DNS stub listener.
+type Resolved struct {
+	d *Detector
+}
+
+// NewResolved returns a Resolved that manages systemd-resolved on the host.
+func NewResolved() *Resolved {
+	return defaultDetector.Resolved()
+}
+
+// Resolved returns a Resolved that runs systemctl with the detector's
+// Runner and writes configuration beneath its Root.
+func (d *Detector) Resolved() *Resolved {
+	return &Resolved{d: d}
+}
+
+// Status reports whether systemd-resolved is active and its stub listener enabled.
+func (r *Resolved) Status(ctx context.Context) (*ResolvedStatus, error) {
+	status := &ResolvedStatus{StubListener: r.stubListenerEnabled()}
+	if target, err := r.d.readLink(resolvConf); err == nil {
+		status.ResolvConfLink = target
+	}
+
+	if r.d.DetectInitSystem() != InitSystemd {
+		return status, nil
+	}
+	unit, err := r.d.Systemd().Status(ctx, "systemd-resolved")
+	if errors.Is(err, ErrUnitNotFound) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.Active = unit.IsActive()
+	return status, nil
+}
+
+// DisableStub turns off the stub listener with a drop-in named after owner,
+// points /etc/resolv.conf at the upstream servers resolved learned, and
+// restarts systemd-resolved. The original /etc/resolv.conf is recorded in
+// the drop-in so RestoreStub can put it back. Calling it again is a no-op.
+func (r *Resolved) DisableStub(ctx context.Context, owner string) error {
+	dropIn, err := r.dropInPath(owner)
+	if err != nil {
+		return err
+	}
+
+	// Keep the original recorded by an earlier call, since resolv.conf has already been relinked
+	original, recorded, err := r.recordedResolvConf(dropIn)
+	if err != nil {
+		return err
+	}
+	if !recorded {
+		if original, err = r.saveResolvConf(); err != nil {
+			return err
+		}
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "# Written by %s to free port 53; removed on uninstall.\n", owner)
+	if original != "" {
+		buf.WriteString(resolvedLinkLabel + original + "\n")
+	}
+	buf.WriteString("[Resolve]\nDNSStubListener=no\n")
+
+	changed, err := r.d.writeFile(dropIn, []byte(buf.String()), 0644)
+	if err != nil {
+		return err
+	}
+	if original != "" {
+		if _, err := r.d.symlink(resolvedUplinks, resolvConf); err != nil {
+			return err
+		}
+	}
+	if changed {
+		return r.restart(ctx)
+	}
+	return nil
+}
+
+// RestoreStub undoes DisableStub for owner: it restores the original
+// /etc/resolv.conf, removes the drop-in and restarts systemd-resolved.
+// A resolv.conf changed by someone else since DisableStub is left alone.
+func (r *Resolved) RestoreStub(ctx context.Context, owner string) error {
+	dropIn, err := r.dropInPath(owner)
+	if err != nil {
+		return err
+	}
+	original, recorded, err := r.recordedResolvConf(dropIn)
+	if err != nil {
+		return err
+	}
+	if !recorded && !r.d.exists(dropIn) {
+		return nil
+	}
+
+	if current, err := r.d.readLink(resolvConf); original != "" && err == nil && current == resolvedUplinks {
+		if original == resolvConfBackup {
+			data, err := r.d.readFile(resolvConfBackup)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", resolvConfBackup, err)
+			}
+			if _, err := r.d.removeFile(resolvConf); err != nil {
+				return err
+			}
+			if _, err := r.d.writeFile(resolvConf, data, 0644); err != nil {
+				return err
+			}
+		} else if _, err := r.d.symlink(original, resolvConf); err != nil {
+			return err
+		}
+	}
+	if original == resolvConfBackup {
+		if _, err := r.d.removeFile(resolvConfBackup); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.d.removeFile(dropIn); err != nil {
+		return err
+	}
+	return r.restart(ctx)
+}
+
+func (r *Resolved) dropInPath(owner string) (string, error) {
+	if !ownerPattern.MatchString(owner) {
+		return "", fmt.Errorf("invalid owner '%s'", owner)
+	}
+	return path.Join(resolvedConfDir, owner+".conf"), nil
+}
+
+// recordedResolvConf returns the original resolv.conf recorded in dropIn.
+func (r *Resolved) recordedResolvConf(dropIn string) (string, bool, error) {
+	data, err := r.d.readFile(dropIn)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	for _, line := range parseLines(string(data), nil) {
+		if original, ok := strings.CutPrefix(line, resolvedLinkLabel); ok {
+			return original, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// saveResolvConf returns what /etc/resolv.conf should be restored to if it
+// depends on the stub: its symlink target, or the backup path of a regular
+// file naming 127.0.0.53. It returns "" if resolv.conf can be left as is.
+func (r *Resolved) saveResolvConf() (string, error) {
+	if target, err := r.d.readLink(resolvConf); err == nil {
+		// stub-resolv.conf, or the static /usr/lib/systemd/resolv.conf, both name 127.0.0.53
+		if path.Base(target) == "stub-resolv.conf" || strings.HasSuffix(target, "/lib/systemd/resolv.conf") {
+			return target, nil
+		}
+		return "", nil
+	}
+
+	data, err := r.d.readFile(resolvConf)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Contains(data, []byte("127.0.0.53")) {
+		return "", nil
+	}
+	if _, err := r.d.writeFile(resolvConfBackup, data, 0644); err != nil {
+		return "", err
+	}
+	return resolvConfBackup, nil
+}
+
+// restart restarts systemd-resolved if it is running, applying drop-in changes.
+func (r *Resolved) restart(ctx context.Context) error {
+	status, err := r.Status(ctx)
+	if err != nil || !status.Active {
+		return err
+	}
+	return r.d.Systemd().Restart(ctx, "systemd-resolved")
+}
+
+// stubListenerEnabled reads DNSStubListener from resolved.conf and its
+// drop-ins, which are applied in file name order.
+func (r *Resolved) stubListenerEnabled() bool {
+	value := "yes"
+	apply := func(name string) {
+		if v, ok := r.resolvedSetting(name, "DNSStubListener"); ok {
+			value = v
+		}
+	}
+
+	if r.d.exists("/etc/systemd/resolved.conf") {
+		apply("/etc/systemd/resolved.conf")
+	} else {
+		apply("/usr/lib/systemd/resolved.conf")
+	}
+
+	// A drop-in in an earlier directory masks one with the same name in a later one
+	dropIns := make(map[string]string)
+	for i := len(resolvedConfDirs) - 1; i >= 0; i-- {
+		entries, err := fs.ReadDir(r.d.FS, fsPath(resolvedConfDirs[i]))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".conf") {
+				dropIns[entry.Name()] = path.Join(resolvedConfDirs[i], entry.Name())
+			}
+		}
+	}
+	names := make([]string, 0, len(dropIns))
+	for name := range dropIns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		apply(dropIns[name])
+	}
+
+	switch strings.ToLower(value) {
+	case "no", "false", "0", "off":
+		return false
+	}
+	return true
+}
+
+// resolvedSetting returns the last value of key in the [Resolve] section of name.
+func (r *Resolved) resolvedSetting(name, key string) (string, bool) {
+	file, err := r.d.open(name)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	var value string
+	var found, inResolve bool
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inResolve = line == "[Resolve]"
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok && inResolve && strings.TrimSpace(k) == key {
+			value, found = strings.TrimSpace(v), true
+		}
+	}
+	return value, found
+}
@@ -0,0 +1,110 @@
+package osdetect
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolvedStubRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		link   string // resolv.conf symlink target, or "" for a regular file
+		data   string
+		backup bool
+	}{
+		{name: "stub link", link: "../run/systemd/resolve/stub-resolv.conf"},
+		{name: "absolute stub link", link: "/run/systemd/resolve/stub-resolv.conf"},
+		{name: "static link", link: "/usr/lib/systemd/resolv.conf"},
+		{name: "regular file", data: "nameserver 127.0.0.53\noptions edns0\n", backup: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			resolv := filepath.Join(root, "etc/resolv.conf")
+			dropIn := filepath.Join(root, "etc/systemd/resolved.conf.d/myapp.conf")
+			writeTestFile(t, root, "run/systemd/resolve/stub-resolv.conf", "nameserver 127.0.0.53\n")
+			writeTestFile(t, root, "run/systemd/resolve/resolv.conf", "nameserver 192.0.2.1\n")
+			writeTestFile(t, root, "etc/hostname", "test\n")
+			if tt.link != "" {
+				if err := os.Symlink(tt.link, resolv); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				writeTestFile(t, root, "etc/resolv.conf", tt.data)
+			}
+
+			d := NewRootDetector(root)
+			d.Runner = &RecordingRunner{}
+			r := d.Resolved()
+			ctx := context.Background()
+
+			// The second call must keep the original recorded by the first
+			for range 2 {
+				if err := r.DisableStub(ctx, "myapp"); err != nil {
+					t.Fatalf("DisableStub() error = %v", err)
+				}
+			}
+			if target, err := os.Readlink(resolv); err != nil || target != resolvedUplinks {
+				t.Errorf("resolv.conf -> %q, %v after DisableStub, want %q", target, err, resolvedUplinks)
+			}
+			data, err := os.ReadFile(dropIn)
+			if err != nil || !strings.Contains(string(data), "DNSStubListener=no\n") {
+				t.Errorf("drop-in = %q, %v, want DNSStubListener=no", data, err)
+			}
+
+			if err := r.RestoreStub(ctx, "myapp"); err != nil {
+				t.Fatalf("RestoreStub() error = %v", err)
+			}
+			if tt.link != "" {
+				if target, err := os.Readlink(resolv); err != nil || target != tt.link {
+					t.Errorf("resolv.conf -> %q, %v after RestoreStub, want %q", target, err, tt.link)
+				}
+			} else {
+				if _, err := os.Readlink(resolv); err == nil {
+					t.Error("resolv.conf is still a symlink after RestoreStub")
+				}
+				if data, err := os.ReadFile(resolv); err != nil || string(data) != tt.data {
+					t.Errorf("resolv.conf = %q, %v, want %q", data, err, tt.data)
+				}
+			}
+			for _, name := range []string{dropIn, filepath.Join(root, "etc/resolv.conf.orig")} {
+				if _, err := os.Lstat(name); !os.IsNotExist(err) {
+					t.Errorf("%s left behind: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestResolvedRestoreKeepsChangedResolvConf(t *testing.T) {
+	root := t.TempDir()
+	resolv := filepath.Join(root, "etc/resolv.conf")
+	writeTestFile(t, root, "etc/hostname", "test\n")
+	if err := os.Symlink("../run/systemd/resolve/stub-resolv.conf", resolv); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewRootDetector(root)
+	d.Runner = &RecordingRunner{}
+	r := d.Resolved()
+	if err := r.DisableStub(context.Background(), "myapp"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Relinked by the administrator after DisableStub
+	if err := os.Remove(resolv); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/resolv.conf.manual", resolv); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RestoreStub(context.Background(), "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	if target, _ := os.Readlink(resolv); target != "/etc/resolv.conf.manual" {
+		t.Errorf("resolv.conf -> %q, want it left alone", target)
+	}
+}
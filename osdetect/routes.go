@@ -0,0 +1,209 @@
+package osdetect
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// AddrFamily is an IP address family.
+type AddrFamily int
+
+const (
+	IPv4 AddrFamily = 4
+	IPv6 AddrFamily = 6
+)
+
+func (f AddrFamily) String() string {
+	return "IPv" + strconv.Itoa(int(f))
+}
+
+// Route flags from linux/route.h.
+const (
+	rtfUp     = 0x0001
+	rtfReject = 0x0200
+)
+
+// ErrNoDefaultRoute is returned when no default route exists for a family.
+var ErrNoDefaultRoute = errors.New("no default route")
+
+// Route is an entry in the kernel's routing tables.
+type Route struct {
+	Family      AddrFamily
+	Destination netip.Prefix // 0.0.0.0/0 or ::/0 for the default route
+	Gateway     netip.Addr   // Invalid for directly connected routes
+	Metric      int
+	Interface   string // e.g., "eth0"
+}
+
+// IsDefault reports whether r is a default route.
+func (r Route) IsDefault() bool {
+	return r.Destination.Bits() == 0
+}
+
+func (r Route) String() string {
+	s := r.Destination.String()
+	if r.Gateway.IsValid() {
+		s += " via " + r.Gateway.String()
+	}
+	return fmt.Sprintf("%s dev %s metric %d", s, r.Interface, r.Metric)
+}
+
+// Routes returns the host's IPv4 and IPv6 routes.
+func Routes() ([]Route, error) {
+	return defaultDetector.Routes()
+}
+
+// Routes returns the usable IPv4 and IPv6 routes from /proc/net/route and
+// /proc/net/ipv6_route. Routes that are down or reject traffic are omitted.
+func (d *Detector) Routes() ([]Route, error) {
+	routes, err := d.ipv4Routes()
+	if err != nil {
+		return nil, err
+	}
+	v6, err := d.ipv6Routes()
+	if err != nil {
+		return nil, err
+	}
+	return append(routes, v6...), nil
+}
+
+// DefaultRoute returns the host's default route for family.
+func DefaultRoute(family AddrFamily) (*Route, error) {
+	return defaultDetector.DefaultRoute(family)
+}
+
+// DefaultRoute returns the default route for family with the lowest
+// metric, or ErrNoDefaultRoute.
+func (d *Detector) DefaultRoute(family AddrFamily) (*Route, error) {
+	var routes []Route
+	var err error
+	switch family {
+	case IPv4:
+		routes, err = d.ipv4Routes()
+	case IPv6:
+		routes, err = d.ipv6Routes()
+	default:
+		return nil, fmt.Errorf("invalid address family %d", family)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var best *Route
+	for i := range routes {
+		if routes[i].IsDefault() && (best == nil || routes[i].Metric < best.Metric) {
+			best = &routes[i]
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("%w for %s", ErrNoDefaultRoute, family)
+	}
+	return best, nil
+}
+
+// ipv4Routes parses /proc/net/route:
+// Iface Destination Gateway Flags RefCnt Use Metric Mask MTU Window IRTT
+func (d *Detector) ipv4Routes() ([]Route, error) {
+	file, err := d.open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var routes []Route
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // skip header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		if flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		dst, err1 := parseProcHexAddr(fields[1])
+		gw, err2 := parseProcHexAddr(fields[2])
+		mask, err3 := parseProcHexAddr(fields[7])
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		metric, _ := strconv.Atoi(fields[6])
+
+		maskBytes := mask.As4()
+		ones, _ := net.IPMask(maskBytes[:]).Size()
+		route := Route{
+			Family:      IPv4,
+			Destination: netip.PrefixFrom(dst, ones),
+			Metric:      metric,
+			Interface:   fields[0],
+		}
+		if !gw.IsUnspecified() {
+			route.Gateway = gw
+		}
+		routes = append(routes, route)
+	}
+	return routes, scanner.Err()
+}
+
+// ipv6Routes parses /proc/net/ipv6_route, which has no header:
+// dest dest_plen src src_plen nexthop metric refcnt use flags iface
+// It returns no routes if IPv6 is disabled.
+func (d *Detector) ipv6Routes() ([]Route, error) {
+	file, err := d.open("/proc/net/ipv6_route")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var routes []Route
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		flags, _ := strconv.ParseUint(fields[8], 16, 32)
+		if flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		dst, err1 := parseIPv6Hex(fields[0])
+		plen, err2 := strconv.ParseUint(fields[1], 16, 8)
+		gw, err3 := parseIPv6Hex(fields[4])
+		metric, err4 := strconv.ParseUint(fields[5], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			continue
+		}
+
+		route := Route{
+			Family:      IPv6,
+			Destination: netip.PrefixFrom(dst, int(plen)),
+			Metric:      int(metric),
+			Interface:   fields[9],
+		}
+		if !gw.IsUnspecified() {
+			route.Gateway = gw
+		}
+		routes = append(routes, route)
+	}
+	return routes, scanner.Err()
+}
+
+// parseIPv6Hex parses an IPv6 address written as 32 hex digits in network order.
+func parseIPv6Hex(s string) (netip.Addr, error) {
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != 16 {
+		return netip.Addr{}, fmt.Errorf("invalid IPv6 address '%s'", s)
+	}
+	return netip.AddrFrom16([16]byte(raw)), nil
+}
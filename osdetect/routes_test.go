@@ -0,0 +1,87 @@
+package osdetect
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// procNetRoute holds a default route on eth0 and a backup on wlan0, a
+// route on a down link, and a reject route; addresses are little-endian.
+const procNetRoute = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+	"eth0\t00000000\t010200C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+	"eth0\t000200C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n" +
+	"wlan0\t00000000\t0100000A\t0003\t0\t0\t600\t00000000\t0\t0\t0\n" +
+	"eth1\t006433C6\t00000000\t0000\t0\t0\t0\t00FFFFFF\t0\t0\t0\n" +
+	"lo\t007100CB\t00000000\t0201\t0\t0\t0\t00FFFFFF\t0\t0\t0\n"
+
+// procNetIPv6Route is in network byte order on every architecture.
+const procNetIPv6Route = "" +
+	"20010db8000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0\n" +
+	"00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eth0\n" +
+	"00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo\n"
+
+func TestRoutes(t *testing.T) {
+	skipUnlessLittleEndian(t)
+
+	d := NewDetector(fstest.MapFS{
+		"proc/net/route":      {Data: []byte(procNetRoute)},
+		"proc/net/ipv6_route": {Data: []byte(procNetIPv6Route)},
+	})
+
+	got, err := d.Routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Route{
+		{Family: IPv4, Destination: netip.MustParsePrefix("0.0.0.0/0"), Gateway: netip.MustParseAddr("192.0.2.1"), Metric: 100, Interface: "eth0"},
+		{Family: IPv4, Destination: netip.MustParsePrefix("192.0.2.0/24"), Metric: 100, Interface: "eth0"},
+		{Family: IPv4, Destination: netip.MustParsePrefix("0.0.0.0/0"), Gateway: netip.MustParseAddr("10.0.0.1"), Metric: 600, Interface: "wlan0"},
+		{Family: IPv6, Destination: netip.MustParsePrefix("2001:db8::/64"), Metric: 256, Interface: "eth0"},
+		{Family: IPv6, Destination: netip.MustParsePrefix("::/0"), Gateway: netip.MustParseAddr("fe80::1"), Metric: 1024, Interface: "eth0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Routes() =\n%v\nwant\n%v", got, want)
+	}
+
+	tests := []struct {
+		family AddrFamily
+		want   string
+	}{
+		{IPv4, "0.0.0.0/0 via 192.0.2.1 dev eth0 metric 100"},
+		{IPv6, "::/0 via fe80::1 dev eth0 metric 1024"},
+	}
+	for _, tt := range tests {
+		route, err := d.DefaultRoute(tt.family)
+		if err != nil {
+			t.Fatalf("DefaultRoute(%s): %v", tt.family, err)
+		}
+		if route.String() != tt.want {
+			t.Errorf("DefaultRoute(%s) = %q, want %q", tt.family, route, tt.want)
+		}
+	}
+
+	if iface, err := d.GetDefaultInterface(); err != nil || iface != "eth0" {
+		t.Errorf("GetDefaultInterface() = %q, %v, want eth0", iface, err)
+	}
+}
+
+func TestDefaultRouteMissing(t *testing.T) {
+	d := NewDetector(fstest.MapFS{
+		"proc/net/route": {Data: []byte("Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+			"eth0\t000200C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n")},
+	})
+
+	if _, err := d.DefaultRoute(IPv4); !errors.Is(err, ErrNoDefaultRoute) {
+		t.Errorf("DefaultRoute(IPv4) error = %v, want ErrNoDefaultRoute", err)
+	}
+	// A missing ipv6_route means IPv6 is disabled
+	if _, err := d.DefaultRoute(IPv6); !errors.Is(err, ErrNoDefaultRoute) {
+		t.Errorf("DefaultRoute(IPv6) error = %v, want ErrNoDefaultRoute", err)
+	}
+	if iface, err := d.GetDefaultInterface(); err != nil || iface != "" {
+		t.Errorf("GetDefaultInterface() = %q, %v, want empty", iface, err)
+	}
+}
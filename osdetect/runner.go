@@ -0,0 +1,295 @@
+package osdetect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Cmd describes a command for a Runner to execute.
+type Cmd struct {
+	Name   string
+	Args   []string
+	Env    []string  // Extra environment variables, e.g., "DEBIAN_FRONTEND=noninteractive"
+	Stdin  io.Reader // Optional input
+	Stdout io.Writer // Optional live copy of output, which is always captured in the Result
+	Stderr io.Writer // Optional live copy of error output
+	Query  bool      // Read-only, so dry runs still execute it
+}
+
+// Command returns a Cmd for name with args.
+func Command(name string, args ...string) Cmd {
+	return Cmd{Name: name, Args: args}
+}
+
+// Query returns a Cmd for a read-only command such as "ufw status", which
+// a DryRunner still executes so that detection keeps working.
+func Query(name string, args ...string) Cmd {
+	return Cmd{Name: name, Args: args, Query: true}
+}
+
+// String returns the command line in shell-quoted form.
+func (c Cmd) String() string {
+	parts := make([]string, 0, len(c.Env)+len(c.Args)+1)
+	for _, env := range c.Env {
+		parts = append(parts, shellQuote(env))
+	}
+	parts = append(parts, shellQuote(c.Name))
+	for _, arg := range c.Args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellQuote quotes s for display if it contains shell metacharacters.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`|&;<>()*?[]{}!#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Result holds the outcome of a command.
+type Result struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// ExitError is returned when a command exits with a non-zero status.
+// It carries the captured output so callers can report why it failed.
+type ExitError struct {
+	Cmd      Cmd
+	ExitCode int
+	Stdout   []byte
+	Stderr   []byte
+}
+
+func newExitError(cmd Cmd, res *Result) *ExitError {
+	return &ExitError{
+		Cmd:      cmd,
+		ExitCode: res.ExitCode,
+		Stdout:   res.Stdout,
+		Stderr:   res.Stderr,
+	}
+}
+
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("%s: exit status %d", e.Cmd, e.ExitCode)
+
+	// Include the last line of stderr, which usually explains the failure
+	stderr := strings.TrimSpace(string(e.Stderr))
+	if i := strings.LastIndexByte(stderr, '\n'); i >= 0 {
+		stderr = stderr[i+1:]
+	}
+	if stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// Runner executes commands and locates executables. All commands run by
+// osdetect go through a Runner, so callers can substitute a dry-run or
+// recording implementation.
+type Runner interface {
+	// Run executes cmd. A non-zero exit status is reported as *ExitError
+	// alongside the Result.
+	Run(ctx context.Context, cmd Cmd) (*Result, error)
+	// LookPath searches for an executable named file, like exec.LookPath.
+	LookPath(file string) (string, error)
+}
+
+// DryRunner is implemented by Runners that describe changes instead of
+// making them. Detector methods check for it to describe file changes in
+// place of writing them, and report accounts they would have created with
+// placeholder IDs.
+type DryRunner interface {
+	Runner
+	// DryRun reports whether changes are described instead of made.
+	DryRun() bool
+	// Describe reports a change that was not made, e.g., "write /etc/hosts".
+	Describe(change string)
+}
+
+// SetDefaultRunner sets the Runner used by the package-level functions.
+// Pass nil to restore the ExecRunner.
+func SetDefaultRunner(r Runner) {
+	defaultDetector.Runner = r
+}
+
+// ExecRunner runs commands on the host.
+type ExecRunner struct{}
+
+// Run executes cmd with os/exec.
+func (ExecRunner) Run(ctx context.Context, cmd Cmd) (*Result, error) {
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	if len(cmd.Env) > 0 {
+		c.Env = append(os.Environ(), cmd.Env...)
+	}
+	c.Stdin = cmd.Stdin
+
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if cmd.Stdout != nil {
+		c.Stdout = io.MultiWriter(&stdout, cmd.Stdout)
+	}
+	if cmd.Stderr != nil {
+		c.Stderr = io.MultiWriter(&stderr, cmd.Stderr)
+	}
+
+	err := c.Run()
+	res := &Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+		// A killed process is reported as the cancellation cause
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return res, fmt.Errorf("%s: %w", cmd, ctxErr)
+		}
+		return res, newExitError(cmd, res)
+	}
+	return res, err
+}
+
+// LookPath calls exec.LookPath.
+func (ExecRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+// DryRunRunner prints commands and file changes instead of making them.
+// Every change succeeds with empty output. Queries (see Cmd.Query) and
+// executable lookups are read-only and still run on the host.
+type DryRunRunner struct {
+	Out io.Writer // Destination for printed changes, defaults to os.Stdout
+}
+
+// Run prints cmd and reports success without executing it, unless cmd is a query.
+func (r DryRunRunner) Run(ctx context.Context, cmd Cmd) (*Result, error) {
+	if cmd.Query {
+		return ExecRunner{}.Run(ctx, cmd)
+	}
+	r.Describe(cmd.String())
+	return &Result{}, nil
+}
+
+// LookPath calls exec.LookPath.
+func (DryRunRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+// DryRun returns true.
+func (DryRunRunner) DryRun() bool {
+	return true
+}
+
+// Describe prints change with a "[dry-run]" prefix.
+func (r DryRunRunner) Describe(change string) {
+	out := r.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, "[dry-run] %s\n", change)
+}
+
+// RecordingRunner records commands without executing them, for use in tests.
+type RecordingRunner struct {
+	// Handler produces the result for each command. If nil, every command
+	// succeeds with empty output. A non-zero Result.ExitCode with a nil
+	// error is reported as *ExitError.
+	Handler func(cmd Cmd) (*Result, error)
+	// Paths maps executable names to the paths LookPath returns. Names
+	// not in Paths are reported as not found.
+	Paths map[string]string
+	// Dry makes the runner act as a DryRunner: file changes are recorded
+	// in Changes instead of being made.
+	Dry bool
+
+	mu       sync.Mutex
+	commands []Cmd
+	changes  []string
+}
+
+// Run records cmd and returns the Handler's result.
+func (r *RecordingRunner) Run(_ context.Context, cmd Cmd) (*Result, error) {
+	r.mu.Lock()
+	r.commands = append(r.commands, cmd)
+	r.mu.Unlock()
+
+	res, err := &Result{}, error(nil)
+	if r.Handler != nil {
+		res, err = r.Handler(cmd)
+		if res == nil {
+			res = &Result{}
+		}
+	}
+
+	if cmd.Stdout != nil {
+		cmd.Stdout.Write(res.Stdout)
+	}
+	if cmd.Stderr != nil {
+		cmd.Stderr.Write(res.Stderr)
+	}
+	if err == nil && res.ExitCode != 0 {
+		err = newExitError(cmd, res)
+	}
+	return res, err
+}
+
+// LookPath returns the path registered in Paths.
+func (r *RecordingRunner) LookPath(file string) (string, error) {
+	if path, ok := r.Paths[file]; ok {
+		return path, nil
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// Commands returns the commands run so far.
+func (r *RecordingRunner) Commands() []Cmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Cmd(nil), r.commands...)
+}
+
+// CommandLines returns the commands run so far in shell-quoted form.
+func (r *RecordingRunner) CommandLines() []string {
+	var lines []string
+	for _, cmd := range r.Commands() {
+		lines = append(lines, cmd.String())
+	}
+	return lines
+}
+
+// DryRun reports whether Dry is set.
+func (r *RecordingRunner) DryRun() bool {
+	return r.Dry
+}
+
+// Describe records change.
+func (r *RecordingRunner) Describe(change string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.changes = append(r.changes, change)
+}
+
+// Changes returns the changes described so far.
+func (r *RecordingRunner) Changes() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.changes...)
+}
+
+// Reset clears the recorded commands and changes.
+func (r *RecordingRunner) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = nil
+	r.changes = nil
+}
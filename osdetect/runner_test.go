@@ -0,0 +1,99 @@
+package osdetect
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDryRunRunner(t *testing.T) {
+	var out bytes.Buffer
+	r := DryRunRunner{Out: &out}
+
+	res, err := r.Run(context.Background(), Command("apk", "add", "nginx"))
+	if err != nil || res == nil {
+		t.Fatalf("Run() = %v, %v, want success", res, err)
+	}
+	r.Describe("write /etc/hosts")
+	if got, want := out.String(), "[dry-run] apk add nginx\n[dry-run] write /etc/hosts\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	// Queries run for real, so a missing executable fails
+	out.Reset()
+	if _, err := r.Run(context.Background(), Query("osdetect-no-such-command")); err == nil {
+		t.Error("Run(query) succeeded without executing the command")
+	}
+	if out.Len() != 0 {
+		t.Errorf("query printed %q", out.String())
+	}
+}
+
+func TestDryRunFileChanges(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "proc/sys/net/ipv4/ip_forward", "0\n")
+	writeTestFile(t, root, "etc/old.conf", "old\n")
+	if err := os.Symlink("stub-resolv.conf", filepath.Join(root, "etc/resolv.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &RecordingRunner{Dry: true}
+	d := NewRootDetector(root)
+	d.Runner = r
+
+	if _, err := d.Systemd().WriteUnit("myapp", []byte("[Unit]\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.SysctlDropIn("myapp").Set("net.ipv4.ip_forward", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.removeFile("/etc/old.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := d.removeFile("/etc/missing.conf"); err != nil || changed {
+		t.Errorf("removeFile(missing) = %v, %v, want false", changed, err)
+	}
+	if _, err := d.symlink("/run/systemd/resolve/resolv.conf", "/etc/resolv.conf"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"write " + filepath.Join(root, "etc/systemd/system/myapp.service"),
+		"write " + filepath.Join(root, "proc/sys/net/ipv4/ip_forward"),
+		"write " + filepath.Join(root, "etc/sysctl.d/99-myapp.conf"),
+		"remove " + filepath.Join(root, "etc/old.conf"),
+		"symlink " + filepath.Join(root, "etc/resolv.conf") + " -> /run/systemd/resolve/resolv.conf",
+	}
+	if got := r.Changes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Changes() =\n%q\nwant\n%q", got, want)
+	}
+
+	// Nothing on disk changed
+	if _, err := os.Stat(filepath.Join(root, "etc/systemd/system/myapp.service")); !os.IsNotExist(err) {
+		t.Errorf("unit file written: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "proc/sys/net/ipv4/ip_forward")); string(data) != "0\n" {
+		t.Errorf("ip_forward = %q, want it unchanged", data)
+	}
+	if _, err := os.Stat(filepath.Join(root, "etc/old.conf")); err != nil {
+		t.Errorf("old.conf removed: %v", err)
+	}
+	if target, _ := os.Readlink(filepath.Join(root, "etc/resolv.conf")); target != "stub-resolv.conf" {
+		t.Errorf("resolv.conf -> %q, want it unchanged", target)
+	}
+}
+
+// writeTestFile creates name beneath root with content.
+func writeTestFile(t *testing.T, root, name, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
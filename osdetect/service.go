@@ -0,0 +1,214 @@
+package osdetect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+)
+
+// ServiceManager starts, stops and enables services using the host's init
+// system. Systemd, OpenRC and SysV implement it.
+type ServiceManager interface {
+	// Init returns the init system the manager drives.
+	Init() InitSystem
+	// Enable configures service to start at boot.
+	Enable(ctx context.Context, service string) error
+	// Disable stops service from starting at boot.
+	Disable(ctx context.Context, service string) error
+	Start(ctx context.Context, service string) error
+	Stop(ctx context.Context, service string) error
+	Restart(ctx context.Context, service string) error
+	// IsActive reports whether service is running.
+	IsActive(ctx context.Context, service string) (bool, error)
+}
+
+// NewServiceManager returns the ServiceManager for the host's init system.
+func NewServiceManager() (ServiceManager, error) {
+	return defaultDetector.ServiceManager()
+}
+
+// ServiceManager returns the ServiceManager for the detected init system.
+func (d *Detector) ServiceManager() (ServiceManager, error) {
+	switch initSystem := d.DetectInitSystem(); initSystem {
+	case InitSystemd:
+		return d.Systemd(), nil
+	case InitOpenRC:
+		return d.OpenRC(), nil
+	case InitSysV:
+		return d.SysV(), nil
+	default:
+		return nil, fmt.Errorf("no supported service manager for init system '%s'", initSystem)
+	}
+}
+
+// Init returns InitSystemd.
+func (s *Systemd) Init() InitSystem {
+	return InitSystemd
+}
+
+// IsActive reports whether unit is active. A unit systemd does not know
+// about is not active, as with OpenRC and SysV.
+func (s *Systemd) IsActive(ctx context.Context, unit string) (bool, error) {
+	status, err := s.Status(ctx, unit)
+	if errors.Is(err, ErrUnitNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return status.IsActive(), nil
+}
+
+// ServiceError is returned when an OpenRC or SysV service operation fails.
+type ServiceError struct {
+	Op      string // e.g., "start", "enable"
+	Service string
+	Err     error // Usually *ExitError with the command's output
+}
+
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("failed to %s %s: %v", e.Op, e.Service, e.Err)
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
+
+// OpenRC manages services with rc-service and rc-update.
+type OpenRC struct {
+	d *Detector
+}
+
+// OpenRC returns an OpenRC that runs commands with the detector's Runner.
+func (d *Detector) OpenRC() *OpenRC {
+	return &OpenRC{d: d}
+}
+
+// Init returns InitOpenRC.
+func (o *OpenRC) Init() InitSystem {
+	return InitOpenRC
+}
+
+// Enable adds service to the default runlevel.
+func (o *OpenRC) Enable(ctx context.Context, service string) error {
+	return runService(ctx, o.d, "enable", service, "rc-update", "add", service, "default")
+}
+
+// Disable removes service from the default runlevel.
+func (o *OpenRC) Disable(ctx context.Context, service string) error {
+	return runService(ctx, o.d, "disable", service, "rc-update", "del", service, "default")
+}
+
+// Start starts service.
+func (o *OpenRC) Start(ctx context.Context, service string) error {
+	return runService(ctx, o.d, "start", service, "rc-service", service, "start")
+}
+
+// Stop stops service.
+func (o *OpenRC) Stop(ctx context.Context, service string) error {
+	return runService(ctx, o.d, "stop", service, "rc-service", service, "stop")
+}
+
+// Restart restarts service.
+func (o *OpenRC) Restart(ctx context.Context, service string) error {
+	return runService(ctx, o.d, "restart", service, "rc-service", service, "restart")
+}
+
+// IsActive reports whether service is started.
+func (o *OpenRC) IsActive(ctx context.Context, service string) (bool, error) {
+	return serviceStatus(ctx, o.d, service, "rc-service", service, "status")
+}
+
+// SysV manages SysV init scripts in /etc/init.d, using update-rc.d on
+// Debian-based systems and chkconfig on Red Hat-based systems.
+type SysV struct {
+	d *Detector
+}
+
+// SysV returns a SysV that runs commands with the detector's Runner.
+func (d *Detector) SysV() *SysV {
+	return &SysV{d: d}
+}
+
+// Init returns InitSysV.
+func (s *SysV) Init() InitSystem {
+	return InitSysV
+}
+
+// Enable creates the runlevel links for service.
+func (s *SysV) Enable(ctx context.Context, service string) error {
+	if s.d.hasCommand("update-rc.d") {
+		return runService(ctx, s.d, "enable", service, "update-rc.d", service, "defaults")
+	}
+	if s.d.hasCommand("chkconfig") {
+		return runService(ctx, s.d, "enable", service, "chkconfig", service, "on")
+	}
+	return &ServiceError{Op: "enable", Service: service, Err: fmt.Errorf("neither update-rc.d nor chkconfig is available")}
+}
+
+// Disable removes the runlevel links for service.
+func (s *SysV) Disable(ctx context.Context, service string) error {
+	if s.d.hasCommand("update-rc.d") {
+		return runService(ctx, s.d, "disable", service, "update-rc.d", "-f", service, "remove")
+	}
+	if s.d.hasCommand("chkconfig") {
+		return runService(ctx, s.d, "disable", service, "chkconfig", service, "off")
+	}
+	return &ServiceError{Op: "disable", Service: service, Err: fmt.Errorf("neither update-rc.d nor chkconfig is available")}
+}
+
+// Start starts service.
+func (s *SysV) Start(ctx context.Context, service string) error {
+	return runService(ctx, s.d, "start", service, s.command(service, "start")...)
+}
+
+// Stop stops service.
+func (s *SysV) Stop(ctx context.Context, service string) error {
+	return runService(ctx, s.d, "stop", service, s.command(service, "stop")...)
+}
+
+// Restart restarts service.
+func (s *SysV) Restart(ctx context.Context, service string) error {
+	return runService(ctx, s.d, "restart", service, s.command(service, "restart")...)
+}
+
+// IsActive reports whether the init script's status action succeeds.
+func (s *SysV) IsActive(ctx context.Context, service string) (bool, error) {
+	return serviceStatus(ctx, s.d, service, s.command(service, "status")...)
+}
+
+// command returns the command line running action for service, preferring
+// service(8) and falling back to invoking the init script directly.
+func (s *SysV) command(service, action string) []string {
+	if s.d.hasCommand("service") {
+		return []string{"service", service, action}
+	}
+	return []string{path.Join("/etc/init.d", service), action}
+}
+
+// runService runs argv, reporting failures as *ServiceError.
+func runService(ctx context.Context, d *Detector, op, service string, argv ...string) error {
+	if err := validateUnit(service); err != nil {
+		return err
+	}
+	if _, err := d.runner().Run(ctx, Command(argv[0], argv[1:]...)); err != nil {
+		return &ServiceError{Op: op, Service: service, Err: err}
+	}
+	return nil
+}
+
+// serviceStatus runs a status command, treating a non-zero exit as "not running".
+func serviceStatus(ctx context.Context, d *Detector, service string, argv ...string) (bool, error) {
+	if err := validateUnit(service); err != nil {
+		return false, err
+	}
+	_, err := d.runner().Run(ctx, Query(argv[0], argv[1:]...))
+	if isExitError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, &ServiceError{Op: "status", Service: service, Err: err}
+	}
+	return true, nil
+}
@@ -0,0 +1,173 @@
+package osdetect
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServiceManagerCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		paths map[string]string
+		init  InitSystem
+		want  []string
+	}{
+		{
+			name:  "systemd",
+			files: fstest.MapFS{"run/systemd/system": {Mode: fs.ModeDir}},
+			init:  InitSystemd,
+			want: []string{
+				"systemctl enable dnsmasq.service",
+				"systemctl restart dnsmasq.service",
+				"systemctl show dnsmasq.service --no-pager --property=LoadState,ActiveState,SubState,UnitFileState,MainPID",
+			},
+		},
+		{
+			name: "openrc",
+			files: fstest.MapFS{
+				"proc/1/comm":          {Data: []byte("init\n")},
+				"run/openrc/softlevel": {Data: []byte("default\n")},
+			},
+			init: InitOpenRC,
+			want: []string{
+				"rc-update add dnsmasq default",
+				"rc-service dnsmasq restart",
+				"rc-service dnsmasq status",
+			},
+		},
+		{
+			name: "sysv with update-rc.d",
+			files: fstest.MapFS{
+				"proc/1/comm": {Data: []byte("init\n")},
+				"etc/inittab": {Data: []byte("id:2:initdefault:\n")},
+			},
+			paths: map[string]string{"update-rc.d": "/usr/sbin/update-rc.d", "service": "/usr/sbin/service"},
+			init:  InitSysV,
+			want: []string{
+				"update-rc.d dnsmasq defaults",
+				"service dnsmasq restart",
+				"service dnsmasq status",
+			},
+		},
+		{
+			name: "sysv with chkconfig",
+			files: fstest.MapFS{
+				"proc/1/comm": {Data: []byte("init\n")},
+				"etc/inittab": {Data: []byte("id:3:initdefault:\n")},
+			},
+			paths: map[string]string{"chkconfig": "/sbin/chkconfig"},
+			init:  InitSysV,
+			want: []string{
+				"chkconfig dnsmasq on",
+				"/etc/init.d/dnsmasq restart",
+				"/etc/init.d/dnsmasq status",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RecordingRunner{Paths: tt.paths, Handler: func(cmd Cmd) (*Result, error) {
+				if cmd.Name == "systemctl" && cmd.Args[0] == "show" {
+					return &Result{Stdout: []byte("LoadState=loaded\nActiveState=active\n")}, nil
+				}
+				return nil, nil
+			}}
+			d := NewDetector(tt.files)
+			d.Runner = r
+
+			sm, err := d.ServiceManager()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sm.Init() != tt.init {
+				t.Fatalf("Init() = %q, want %q", sm.Init(), tt.init)
+			}
+
+			ctx := context.Background()
+			if err := sm.Enable(ctx, "dnsmasq"); err != nil {
+				t.Fatal(err)
+			}
+			if err := sm.Restart(ctx, "dnsmasq"); err != nil {
+				t.Fatal(err)
+			}
+			if active, err := sm.IsActive(ctx, "dnsmasq"); err != nil || !active {
+				t.Errorf("IsActive() = %v, %v, want true", active, err)
+			}
+			if got := r.CommandLines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceErrors(t *testing.T) {
+	r := &RecordingRunner{Handler: func(Cmd) (*Result, error) {
+		return &Result{ExitCode: 3, Stderr: []byte("stopped")}, nil
+	}}
+	d := NewDetector(fstest.MapFS{})
+	d.Runner = r
+	ctx := context.Background()
+
+	// A failing status command means the service is stopped
+	if active, err := d.OpenRC().IsActive(ctx, "dnsmasq"); err != nil || active {
+		t.Errorf("IsActive() = %v, %v, want false", active, err)
+	}
+
+	var svcErr *ServiceError
+	if err := d.OpenRC().Start(ctx, "dnsmasq"); !errors.As(err, &svcErr) || svcErr.Op != "start" {
+		t.Errorf("Start() error = %v, want *ServiceError", err)
+	}
+	var exitErr *ExitError
+	if err := d.SysV().Stop(ctx, "dnsmasq"); !errors.As(err, &exitErr) || exitErr.ExitCode != 3 {
+		t.Errorf("Stop() error = %v, want exit status 3", err)
+	}
+
+	r.Reset()
+	if err := d.OpenRC().Start(ctx, "../etc/passwd"); err == nil {
+		t.Error("Start accepted an invalid service name")
+	}
+	if got := r.CommandLines(); len(got) != 0 {
+		t.Errorf("commands = %q, want none", got)
+	}
+}
+
+func TestSystemdStatus(t *testing.T) {
+	show := "LoadState=loaded\nActiveState=active\nSubState=running\nUnitFileState=enabled\nMainPID=812\n"
+	d := NewDetector(fstest.MapFS{})
+	d.Runner = &RecordingRunner{Handler: func(Cmd) (*Result, error) {
+		return &Result{Stdout: []byte(show)}, nil
+	}}
+
+	status, err := d.Systemd().Status(context.Background(), "sshd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &UnitStatus{
+		Unit:          "sshd.service",
+		LoadState:     "loaded",
+		ActiveState:   "active",
+		SubState:      "running",
+		UnitFileState: "enabled",
+		MainPID:       812,
+	}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("Status() = %+v, want %+v", status, want)
+	}
+	if !status.IsActive() || !status.IsEnabled() {
+		t.Errorf("IsActive() = %v, IsEnabled() = %v, want both true", status.IsActive(), status.IsEnabled())
+	}
+
+	show = "LoadState=not-found\nActiveState=inactive\n"
+	if _, err := d.Systemd().Status(context.Background(), "nope"); !errors.Is(err, ErrUnitNotFound) {
+		t.Errorf("Status() error = %v, want ErrUnitNotFound", err)
+	}
+	// Like OpenRC and SysV, an unknown service is not running
+	if active, err := d.Systemd().IsActive(context.Background(), "nope"); err != nil || active {
+		t.Errorf("IsActive() = %v, %v, want false", active, err)
+	}
+}
@@ -0,0 +1,273 @@
+package osdetect
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Socket states as reported in /proc/net/tcp and /proc/net/udp.
+const (
+	tcpEstablished = 0x01
+	udpUnconnected = 0x07 // TCP_CLOSE, used for UDP sockets without a peer
+	tcpListen      = 0x0A
+)
+
+// procSocket is an entry in /proc/net/{tcp,tcp6,udp,udp6}.
+type procSocket struct {
+	Local  netip.AddrPort
+	Remote netip.AddrPort
+	State  int
+	UID    int
+	Inode  uint64
+}
+
+// Listener is a socket accepting connections or datagrams on a local port.
+type Listener struct {
+	Protocol Protocol
+	Addr     netip.AddrPort // Unspecified address (0.0.0.0 or ::) for all interfaces
+	UID      int
+	Inode    uint64
+	PID      int    // 0 if the owning process is not visible, e.g., without root
+	Process  string // Command name of the owning process, e.g., "systemd-resolve"
+}
+
+func (l Listener) String() string {
+	owner := "unknown process"
+	if l.PID != 0 {
+		owner = fmt.Sprintf("%s (pid %d)", l.Process, l.PID)
+	}
+	return fmt.Sprintf("%d/%s on %s by %s", l.Addr.Port(), l.Protocol, l.Addr.Addr(), owner)
+}
+
+// Columns returns the listener as table columns: port/proto, address,
+// process and PID, e.g., for tui.InfoRow.
+func (l Listener) Columns() []string {
+	process, pid := "?", "-"
+	if l.PID != 0 {
+		process, pid = l.Process, strconv.Itoa(l.PID)
+	}
+	return []string{fmt.Sprintf("%d/%s", l.Addr.Port(), l.Protocol), l.Addr.Addr().String(), process, pid}
+}
+
+// Listeners returns the host's listening TCP and UDP sockets.
+func Listeners() ([]Listener, error) {
+	return defaultDetector.Listeners()
+}
+
+// Listeners returns listening TCP sockets and unconnected UDP sockets from
+// /proc/net, sorted by port, with their owning processes from /proc/<pid>/fd.
+func (d *Detector) Listeners() ([]Listener, error) {
+	var listeners []Listener
+	for _, table := range []struct {
+		name  string
+		proto Protocol
+	}{
+		{"/proc/net/tcp", TCP},
+		{"/proc/net/tcp6", TCP},
+		{"/proc/net/udp", UDP},
+		{"/proc/net/udp6", UDP},
+	} {
+		sockets, err := d.readProcNet(table.name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // IPv6 disabled
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", table.name, err)
+		}
+
+		for _, s := range sockets {
+			listening := s.State == tcpListen
+			if table.proto == UDP {
+				listening = s.Remote.Port() == 0 && s.State == udpUnconnected
+			}
+			if listening {
+				listeners = append(listeners, Listener{Protocol: table.proto, Addr: s.Local, UID: s.UID, Inode: s.Inode})
+			}
+		}
+	}
+
+	owners := d.socketOwners()
+	for i := range listeners {
+		if pid, ok := owners[listeners[i].Inode]; ok {
+			listeners[i].PID = pid
+			listeners[i].Process = d.processComm(strconv.Itoa(pid))
+		}
+	}
+
+	sort.SliceStable(listeners, func(i, j int) bool {
+		a, b := listeners[i], listeners[j]
+		if a.Addr.Port() != b.Addr.Port() {
+			return a.Addr.Port() < b.Addr.Port()
+		}
+		return a.Protocol < b.Protocol
+	})
+	return listeners, nil
+}
+
+// ListenersOnPort returns the host's sockets listening on port.
+func ListenersOnPort(port int, proto Protocol) ([]Listener, error) {
+	return defaultDetector.ListenersOnPort(port, proto)
+}
+
+// ListenersOnPort returns the sockets listening on port, answering "who is
+// using port 53/udp". The result is empty if the port is free.
+func (d *Detector) ListenersOnPort(port int, proto Protocol) ([]Listener, error) {
+	listeners, err := d.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	var matched []Listener
+	for _, l := range listeners {
+		if int(l.Addr.Port()) == port && l.Protocol == proto {
+			matched = append(matched, l)
+		}
+	}
+	return matched, nil
+}
+
+// socketOwners maps socket inodes to the PID of a process holding them.
+// Processes whose fds cannot be read are skipped.
+func (d *Detector) socketOwners() map[uint64]int {
+	owners := make(map[uint64]int)
+	entries, err := fs.ReadDir(d.FS, "proc")
+	if err != nil {
+		return owners
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		inodes, err := d.socketInodes(entry.Name())
+		if err != nil {
+			continue
+		}
+		for inode := range inodes {
+			if _, ok := owners[inode]; !ok {
+				owners[inode] = pid
+			}
+		}
+	}
+	return owners
+}
+
+// readProcNet parses a socket table such as /proc/net/tcp.
+func (d *Detector) readProcNet(name string) ([]procSocket, error) {
+	file, err := d.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sockets []procSocket
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // Skip header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, err := parseProcNetAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		remote, err := parseProcNetAddr(fields[2])
+		if err != nil {
+			continue
+		}
+		state, _ := strconv.ParseInt(fields[3], 16, 0)
+		uid, _ := strconv.Atoi(fields[7])
+		inode, _ := strconv.ParseUint(fields[9], 10, 64)
+
+		sockets = append(sockets, procSocket{Local: local, Remote: remote, State: int(state), UID: uid, Inode: inode})
+	}
+	return sockets, scanner.Err()
+}
+
+// parseProcNetAddr parses an address such as "0100007F:0035", where the
+// port is big-endian hex.
+func parseProcNetAddr(s string) (netip.AddrPort, error) {
+	addrHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("invalid socket address '%s'", s)
+	}
+	addr, err := parseProcHexAddr(addrHex)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid socket port '%s'", s)
+	}
+	return netip.AddrPortFrom(addr, uint16(port)), nil
+}
+
+// parseProcHexAddr parses an IPv4 or IPv6 address written by the kernel as
+// hex in host byte order, in 32-bit words, as in /proc/net/tcp and /proc/net/route.
+func parseProcHexAddr(s string) (netip.Addr, error) {
+	raw, err := hex.DecodeString(s)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return netip.Addr{}, fmt.Errorf("invalid address '%s'", s)
+	}
+
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(raw[i:], binary.NativeEndian.Uint32(raw[i:]))
+	}
+	addr, _ := netip.AddrFromSlice(raw)
+	return addr.Unmap(), nil
+}
+
+// socketInodes returns the inodes of the sockets open in process pid.
+func (d *Detector) socketInodes(pid string) (map[uint64]bool, error) {
+	fdDir := path.Join("/proc", pid, "fd")
+	entries, err := fs.ReadDir(d.FS, fsPath(fdDir))
+	if err != nil {
+		return nil, err
+	}
+
+	inodes := make(map[uint64]bool)
+	for _, entry := range entries {
+		target, err := d.readLink(path.Join(fdDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		// Socket links look like "socket:[12345]"
+		if s, ok := strings.CutPrefix(target, "socket:["); ok {
+			if inode, err := strconv.ParseUint(strings.TrimSuffix(s, "]"), 10, 64); err == nil {
+				inodes[inode] = true
+			}
+		}
+	}
+	return inodes, nil
+}
+
+// processParent returns the command name and parent PID of process pid.
+func (d *Detector) processParent(pid string) (comm string, ppid int, err error) {
+	data, err := d.readFile(path.Join("/proc", pid, "stat"))
+	if err != nil {
+		return "", 0, err
+	}
+
+	// "pid (comm) state ppid ...", where comm may itself contain spaces and parentheses
+	stat := string(data)
+	open, end := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return "", 0, fmt.Errorf("invalid stat for process %s", pid)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 2 {
+		return "", 0, fmt.Errorf("invalid stat for process %s", pid)
+	}
+	ppid, err = strconv.Atoi(fields[1])
+	return stat[open+1 : end], ppid, err
+}
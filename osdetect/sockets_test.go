@@ -0,0 +1,116 @@
+package osdetect
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// The fixtures below were captured on x86_64, where the kernel prints each
+// 32-bit address word in little-endian order.
+func skipUnlessLittleEndian(t *testing.T) {
+	t.Helper()
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("fixtures are from a little-endian kernel")
+	}
+}
+
+const (
+	procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 3500007F:0035 00000000:0000 0A 00000000:00000000 00:00000000 00000000   101        0 20118 1 0000000000000000 100 0 0 10 5
+   1: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 21034 1 0000000000000000 100 0 0 10 0
+   2: 0F02000A:0016 0202000A:C3A2 01 00000000:00000000 02:0009F1C5 00000000     0        0 48262 4 0000000000000000 20 4 31 10 17
+`
+	procNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:0016 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 21036 1 0000000000000000 100 0 0 10 0
+   1: B80D0120000000000000000001000000:01BB 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000    33        0 30551 1 0000000000000000 100 0 0 10 0
+   2: 0000000000000000FFFF00000F02000A:0016 0000000000000000FFFF00000202000A:C3A4 01 00000000:00000000 02:00098A27 00000000     0        0 48301 2 0000000000000000 20 4 30 10 -1
+`
+	procNetUDP = `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  317: 3500007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000   101        0 20117 2 0000000000000000 0
+  598: 0F02000A:9C40 0101A8C0:0035 01 00000000:00000000 00:00000000 00000000  1000        0 51023 2 0000000000000000 0
+`
+)
+
+func TestParseProcNetAddr(t *testing.T) {
+	skipUnlessLittleEndian(t)
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"3500007F:0035", "127.0.0.53:53"},
+		{"00000000:0016", "0.0.0.0:22"},
+		{"0F02000A:C3A2", "10.0.2.15:50082"},
+		{"B80D0120000000000000000001000000:01BB", "[2001:db8::1]:443"},
+		{"00000000000000000000000001000000:0035", "[::1]:53"},
+		{"000080FE00000000FF27000AA1664EFE:0016", "[fe80::a00:27ff:fe4e:66a1]:22"},
+		{"0000000000000000FFFF00000F02000A:0016", "10.0.2.15:22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got, err := parseProcNetAddr(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("parseProcNetAddr(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProcNetAddrInvalid(t *testing.T) {
+	for _, input := range []string{"", "0100007F", "0100007F:XYZ", "zz00007F:0035", "01007F:0035"} {
+		if got, err := parseProcNetAddr(input); err == nil {
+			t.Errorf("parseProcNetAddr(%q) = %s, want error", input, got)
+		}
+	}
+}
+
+func TestListeners(t *testing.T) {
+	skipUnlessLittleEndian(t)
+
+	d := NewDetector(fstest.MapFS{
+		"proc/net/tcp":  {Data: []byte(procNetTCP)},
+		"proc/net/tcp6": {Data: []byte(procNetTCP6)},
+		"proc/net/udp":  {Data: []byte(procNetUDP)},
+		// udp6 is missing when IPv6 is disabled
+	})
+
+	got, err := d.Listeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Listener{
+		{Protocol: TCP, Addr: netip.MustParseAddrPort("0.0.0.0:22"), UID: 0, Inode: 21034},
+		{Protocol: TCP, Addr: netip.MustParseAddrPort("[::]:22"), UID: 0, Inode: 21036},
+		{Protocol: TCP, Addr: netip.MustParseAddrPort("127.0.0.53:53"), UID: 101, Inode: 20118},
+		{Protocol: UDP, Addr: netip.MustParseAddrPort("127.0.0.53:53"), UID: 101, Inode: 20117},
+		{Protocol: TCP, Addr: netip.MustParseAddrPort("[2001:db8::1]:443"), UID: 33, Inode: 30551},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Listeners() =\n%v\nwant\n%v", got, want)
+	}
+
+	onPort, err := d.ListenersOnPort(53, UDP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(onPort) != 1 || onPort[0].Inode != 20117 {
+		t.Errorf("ListenersOnPort(53, udp) = %v, want the inode 20117 socket", onPort)
+	}
+}
+
+func TestListenerString(t *testing.T) {
+	l := Listener{Protocol: UDP, Addr: netip.MustParseAddrPort("127.0.0.53:53"), PID: 612, Process: "systemd-resolve"}
+	if got, want := l.String(), "53/udp on 127.0.0.53 by systemd-resolve (pid 612)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	l.PID = 0
+	if got, want := l.Columns(), []string{"53/udp", "127.0.0.53", "?", "-"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Columns() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+package osdetect
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const sshdConfigPath = "/etc/ssh/sshd_config"
+
+// sshdMaxIncludeDepth matches sshd's limit on nested Include directives.
+const sshdMaxIncludeDepth = 16
+
+// SSHDSetting is a keyword in sshd_config and where it was set.
+type SSHDSetting struct {
+	Keyword string // As written, e.g., "PermitRootLogin"
+	Value   string // Arguments, e.g., "prohibit-password"
+	File    string // e.g., "/etc/ssh/sshd_config.d/50-cloud-init.conf"
+	Line    int
+	Match   string // Criteria of the enclosing Match block, e.g., "User admin"; empty if global
+}
+
+func (s SSHDSetting) String() string {
+	return fmt.Sprintf("%s:%d: %s %s", s.File, s.Line, s.Keyword, s.Value)
+}
+
+// SSHDListen is an address and port sshd listens on.
+type SSHDListen struct {
+	Host string // Address or host name; empty for all addresses
+	Port int
+}
+
+func (l SSHDListen) String() string {
+	return net.JoinHostPort(l.Host, strconv.Itoa(l.Port))
+}
+
+// SSHDConfig is the parsed sshd configuration, including Include files.
+type SSHDConfig struct {
+	Ports  []int        // Port values, or 22 if unset
+	Listen []SSHDListen // Combined from ListenAddress and Port
+
+	// Global values with sshd's defaults applied. Match blocks may
+	// override them for some connections; see Settings.
+	PermitRootLogin        string // e.g., "prohibit-password", "yes", "no"
+	PasswordAuthentication string // "yes" or "no"
+
+	Settings []SSHDSetting // Every setting in the order sshd reads them
+	Files    []string      // Files read, in order
+}
+
+// Setting returns the effective global setting for keyword, or nil if it
+// is not set outside Match blocks. As in sshd, the first value read wins.
+func (c *SSHDConfig) Setting(keyword string) *SSHDSetting {
+	for i, s := range c.Settings {
+		if s.Match == "" && strings.EqualFold(s.Keyword, keyword) {
+			return &c.Settings[i]
+		}
+	}
+	return nil
+}
+
+// ListenPorts returns the distinct ports sshd listens on.
+func (c *SSHDConfig) ListenPorts() []int {
+	var ports []int
+	seen := make(map[int]bool)
+	for _, l := range c.Listen {
+		if !seen[l.Port] {
+			seen[l.Port] = true
+			ports = append(ports, l.Port)
+		}
+	}
+	return ports
+}
+
+// ReadSSHDConfig parses the host's sshd configuration.
+func ReadSSHDConfig() (*SSHDConfig, error) {
+	return defaultDetector.ReadSSHDConfig()
+}
+
+// ReadSSHDConfig parses /etc/ssh/sshd_config and the files it includes,
+// such as /etc/ssh/sshd_config.d/*.conf.
+func (d *Detector) ReadSSHDConfig() (*SSHDConfig, error) {
+	cfg := &SSHDConfig{}
+	if err := d.parseSSHDConfigFile(cfg, sshdConfigPath, "", 0); err != nil {
+		return nil, err
+	}
+
+	var listenAddrs []string
+	for _, s := range cfg.Settings {
+		if s.Match != "" {
+			continue
+		}
+		switch strings.ToLower(s.Keyword) {
+		case "port":
+			port, err := strconv.Atoi(s.Value)
+			if err != nil || port < 1 || port > 65535 {
+				return nil, fmt.Errorf("%s:%d: invalid port '%s'", s.File, s.Line, s.Value)
+			}
+			cfg.Ports = append(cfg.Ports, port)
+		case "listenaddress":
+			listenAddrs = append(listenAddrs, s.Value)
+		}
+	}
+	if len(cfg.Ports) == 0 {
+		cfg.Ports = []int{22}
+	}
+
+	// A ListenAddress with its own port ignores Port
+	if len(listenAddrs) == 0 {
+		listenAddrs = []string{""}
+	}
+	for _, addr := range listenAddrs {
+		host, port := parseSSHDListenAddress(addr)
+		if port != 0 {
+			cfg.Listen = append(cfg.Listen, SSHDListen{Host: host, Port: port})
+			continue
+		}
+		for _, p := range cfg.Ports {
+			cfg.Listen = append(cfg.Listen, SSHDListen{Host: host, Port: p})
+		}
+	}
+
+	cfg.PermitRootLogin = "prohibit-password"
+	if s := cfg.Setting("PermitRootLogin"); s != nil {
+		cfg.PermitRootLogin = s.Value
+	}
+	cfg.PasswordAuthentication = "yes"
+	if s := cfg.Setting("PasswordAuthentication"); s != nil {
+		cfg.PasswordAuthentication = s.Value
+	}
+	return cfg, nil
+}
+
+// parseSSHDConfigFile appends the settings in name to cfg. A Match block
+// lasts until the next Match or the end of the file it appears in.
+func (d *Detector) parseSSHDConfigFile(cfg *SSHDConfig, name, match string, depth int) error {
+	if depth > sshdMaxIncludeDepth {
+		return fmt.Errorf("%s: too many nested includes", name)
+	}
+	file, err := d.open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	cfg.Files = append(cfg.Files, name)
+
+	lineNum := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNum++
+		keyword, value := splitSSHDLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+
+		switch strings.ToLower(keyword) {
+		case "match":
+			match = value
+			if strings.EqualFold(value, "all") {
+				match = ""
+			}
+		case "include":
+			for _, pattern := range strings.Fields(value) {
+				if !path.IsAbs(pattern) {
+					pattern = path.Join("/etc/ssh", pattern)
+				}
+				matches, err := fs.Glob(d.FS, fsPath(pattern))
+				if err != nil {
+					return fmt.Errorf("%s:%d: %w", name, lineNum, err)
+				}
+				for _, m := range matches {
+					err := d.parseSSHDConfigFile(cfg, "/"+m, match, depth+1)
+					if err != nil && !errors.Is(err, fs.ErrNotExist) {
+						return err
+					}
+				}
+			}
+		default:
+			cfg.Settings = append(cfg.Settings, SSHDSetting{
+				Keyword: keyword,
+				Value:   value,
+				File:    name,
+				Line:    lineNum,
+				Match:   match,
+			})
+		}
+	}
+	return scanner.Err()
+}
+
+// splitSSHDLine splits a config line into its keyword and arguments, which
+// may be separated by whitespace or '='. It returns "" for blank lines and comments.
+func splitSSHDLine(line string) (keyword, value string) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return "", ""
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return line, ""
+	}
+	value = strings.TrimSpace(line[end:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return line[:end], value
+}
+
+// parseSSHDListenAddress parses "host", "host:port", "[v6]:port" or a bare
+// IPv6 address, optionally followed by an rdomain. Port is 0 if not given.
+func parseSSHDListenAddress(value string) (host string, port int) {
+	addr, _, _ := strings.Cut(value, " ")
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		if port, err := strconv.Atoi(p); err == nil {
+			return h, port
+		}
+	}
+	return strings.Trim(addr, "[]"), 0
+}
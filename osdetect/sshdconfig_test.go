@@ -0,0 +1,184 @@
+package osdetect
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadSSHDConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     fstest.MapFS
+		wantPorts []int
+		wantList  []SSHDListen
+		wantRoot  string
+		wantPass  string
+		wantFiles []string
+	}{
+		{
+			name:      "defaults",
+			files:     fstest.MapFS{"etc/ssh/sshd_config": {Data: []byte("# empty\n")}},
+			wantPorts: []int{22},
+			wantList:  []SSHDListen{{Port: 22}},
+			wantRoot:  "prohibit-password",
+			wantPass:  "yes",
+			wantFiles: []string{"/etc/ssh/sshd_config"},
+		},
+		{
+			name: "include first value wins",
+			files: fstest.MapFS{
+				"etc/ssh/sshd_config": {Data: []byte(
+					"Include /etc/ssh/sshd_config.d/*.conf\n" +
+						"Port 22\n" +
+						"PasswordAuthentication yes\n")},
+				"etc/ssh/sshd_config.d/50-cloud-init.conf": {Data: []byte("PasswordAuthentication no\n")},
+				"etc/ssh/sshd_config.d/60-port.conf":       {Data: []byte("Port 2222\n")},
+			},
+			wantPorts: []int{2222, 22},
+			wantList:  []SSHDListen{{Port: 2222}, {Port: 22}},
+			wantRoot:  "prohibit-password",
+			wantPass:  "no",
+			wantFiles: []string{
+				"/etc/ssh/sshd_config",
+				"/etc/ssh/sshd_config.d/50-cloud-init.conf",
+				"/etc/ssh/sshd_config.d/60-port.conf",
+			},
+		},
+		{
+			name: "relative include and missing glob",
+			files: fstest.MapFS{
+				"etc/ssh/sshd_config":  {Data: []byte("Include extra.conf missing.d/*\nPermitRootLogin=no\n")},
+				"etc/ssh/extra.conf":   {Data: []byte("permitrootlogin yes\n")},
+				"etc/ssh/unused.conf":  {Data: []byte("Port 1\n")},
+				"etc/ssh/moduli":       {Data: []byte("")},
+				"etc/ssh/ssh_config":   {Data: []byte("Port 2\n")},
+				"etc/ssh/ssh_host_key": {Data: []byte("")},
+			},
+			wantPorts: []int{22},
+			wantList:  []SSHDListen{{Port: 22}},
+			wantRoot:  "yes",
+			wantPass:  "yes",
+			wantFiles: []string{"/etc/ssh/sshd_config", "/etc/ssh/extra.conf"},
+		},
+		{
+			name: "match block does not leak",
+			files: fstest.MapFS{
+				"etc/ssh/sshd_config": {Data: []byte(
+					"Include sshd_config.d/*.conf\n" +
+						"Match User admin\n" +
+						"    PasswordAuthentication yes\n" +
+						"Match all\n" +
+						"PermitRootLogin no\n")},
+				"etc/ssh/sshd_config.d/10-match.conf": {Data: []byte("Match Address 10.0.0.0/8\nPort 2200\n")},
+				"etc/ssh/sshd_config.d/20-auth.conf":  {Data: []byte("PasswordAuthentication no\n")},
+			},
+			wantPorts: []int{22},
+			wantList:  []SSHDListen{{Port: 22}},
+			wantRoot:  "no",
+			wantPass:  "no",
+			wantFiles: []string{
+				"/etc/ssh/sshd_config",
+				"/etc/ssh/sshd_config.d/10-match.conf",
+				"/etc/ssh/sshd_config.d/20-auth.conf",
+			},
+		},
+		{
+			name: "listen addresses",
+			files: fstest.MapFS{
+				"etc/ssh/sshd_config": {Data: []byte(
+					"Port 22\nPort 2222\n" +
+						"ListenAddress 192.0.2.1\n" +
+						"ListenAddress [2001:db8::1]:443\n" +
+						"ListenAddress ::1 rdomain 1\n")},
+			},
+			wantPorts: []int{22, 2222},
+			wantList: []SSHDListen{
+				{Host: "192.0.2.1", Port: 22},
+				{Host: "192.0.2.1", Port: 2222},
+				{Host: "2001:db8::1", Port: 443},
+				{Host: "::1", Port: 22},
+				{Host: "::1", Port: 2222},
+			},
+			wantRoot:  "prohibit-password",
+			wantPass:  "yes",
+			wantFiles: []string{"/etc/ssh/sshd_config"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := NewDetector(tt.files).ReadSSHDConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.Ports, tt.wantPorts) {
+				t.Errorf("Ports = %v, want %v", cfg.Ports, tt.wantPorts)
+			}
+			if !reflect.DeepEqual(cfg.Listen, tt.wantList) {
+				t.Errorf("Listen = %v, want %v", cfg.Listen, tt.wantList)
+			}
+			if cfg.PermitRootLogin != tt.wantRoot {
+				t.Errorf("PermitRootLogin = %q, want %q", cfg.PermitRootLogin, tt.wantRoot)
+			}
+			if cfg.PasswordAuthentication != tt.wantPass {
+				t.Errorf("PasswordAuthentication = %q, want %q", cfg.PasswordAuthentication, tt.wantPass)
+			}
+			if !reflect.DeepEqual(cfg.Files, tt.wantFiles) {
+				t.Errorf("Files = %v, want %v", cfg.Files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestReadSSHDConfigMatchSetting(t *testing.T) {
+	d := NewDetector(fstest.MapFS{
+		"etc/ssh/sshd_config": {Data: []byte("PermitRootLogin no\nMatch User backup\n  PermitRootLogin yes\n")},
+	})
+	cfg, err := d.ReadSSHDConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Settings) != 2 {
+		t.Fatalf("Settings = %v, want 2 entries", cfg.Settings)
+	}
+	if s := cfg.Settings[1]; s.Match != "User backup" || s.Value != "yes" || s.Line != 3 {
+		t.Errorf("Settings[1] = %+v, want the Match User backup override on line 3", s)
+	}
+}
+
+func TestReadSSHDConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"missing", fstest.MapFS{}},
+		{"invalid port", fstest.MapFS{"etc/ssh/sshd_config": {Data: []byte("Port ssh\n")}}},
+		{"include loop", fstest.MapFS{"etc/ssh/sshd_config": {Data: []byte("Include /etc/ssh/sshd_config\n")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDetector(tt.files).ReadSSHDConfig(); err == nil {
+				t.Error("ReadSSHDConfig succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestDetectSSHPort(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{"no config", fstest.MapFS{}, "22"},
+		{"port", fstest.MapFS{"etc/ssh/sshd_config": {Data: []byte("Port 2222\n")}}, "2222"},
+		{"listen address port", fstest.MapFS{"etc/ssh/sshd_config": {Data: []byte("ListenAddress 0.0.0.0:8022\n")}}, "8022"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewDetector(tt.files).DetectSSHPort(); got != tt.want {
+				t.Errorf("DetectSSHPort() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
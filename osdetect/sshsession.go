@@ -0,0 +1,187 @@
+package osdetect
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSSHSession is returned when the current process is not running under SSH.
+var ErrNoSSHSession = errors.New("not running in an SSH session")
+
+// SSHSession is the SSH connection the current process is running under.
+type SSHSession struct {
+	Client netip.AddrPort
+	Server netip.AddrPort // Server address is invalid when only SSH_CLIENT is set
+	Source string         // "SSH_CONNECTION", "SSH_CLIENT", "socket" or "sshd_config"
+
+	// Ports lists every port sshd listens on when the connection itself
+	// could not be found (Source "sshd_config"); all of them are guarded.
+	Ports []int
+}
+
+// Port returns the server port the session came in on, or 0 if it is unknown.
+func (s *SSHSession) Port() int {
+	return int(s.Server.Port())
+}
+
+// guardedPorts returns the ports the session may depend on.
+func (s *SSHSession) guardedPorts() []int {
+	if s.Port() == 0 {
+		return s.Ports
+	}
+	return []int{s.Port()}
+}
+
+// CurrentSSHSession returns the SSH session the current process is running under.
+func CurrentSSHSession() (*SSHSession, error) {
+	return defaultDetector.CurrentSSHSession()
+}
+
+// CurrentSSHSession returns the SSH session the current process is running
+// under, or ErrNoSSHSession. It reads SSH_CONNECTION and SSH_CLIENT, which
+// sudo usually strips, and falls back to finding the connection held by
+// the nearest sshd ancestor in the socket table. If that process's sockets
+// cannot be read, the session is reported with every port from
+// sshd_config, so that none of them is closed.
+func (d *Detector) CurrentSSHSession() (*SSHSession, error) {
+	// SSH_CONNECTION is "client_ip client_port server_ip server_port"
+	if fields := strings.Fields(d.getenv("SSH_CONNECTION")); len(fields) == 4 {
+		client, err1 := parseAddrPort(fields[0], fields[1])
+		server, err2 := parseAddrPort(fields[2], fields[3])
+		if err1 == nil && err2 == nil {
+			return &SSHSession{Client: client, Server: server, Source: "SSH_CONNECTION"}, nil
+		}
+	}
+
+	// SSH_CLIENT is "client_ip client_port server_port"
+	if fields := strings.Fields(d.getenv("SSH_CLIENT")); len(fields) == 3 {
+		client, err1 := parseAddrPort(fields[0], fields[1])
+		port, err2 := strconv.ParseUint(fields[2], 10, 16)
+		if err1 == nil && err2 == nil {
+			server := netip.AddrPortFrom(netip.Addr{}, uint16(port))
+			return &SSHSession{Client: client, Server: server, Source: "SSH_CLIENT"}, nil
+		}
+	}
+
+	return d.sshSessionFromSockets()
+}
+
+// sshSessionFromSockets finds the established TCP connection owned by the
+// nearest sshd ancestor of the current process.
+func (d *Detector) sshSessionFromSockets() (*SSHSession, error) {
+	pid := "self"
+	for i := 0; i < 64; i++ {
+		comm, ppid, err := d.processParent(pid)
+		if err != nil {
+			break
+		}
+
+		// OpenSSH 9.8 and later run sessions in sshd-session
+		if comm == "sshd" || comm == "sshd-session" {
+			inodes, err := d.socketInodes(pid)
+			if errors.Is(err, fs.ErrPermission) {
+				return d.sshSessionFromConfig(), nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to inspect sshd process %s: %w", pid, err)
+			}
+			for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+				sockets, err := d.readProcNet(table)
+				if err != nil {
+					continue
+				}
+				for _, s := range sockets {
+					if s.State == tcpEstablished && inodes[s.Inode] {
+						return &SSHSession{Client: s.Remote, Server: s.Local, Source: "socket"}, nil
+					}
+				}
+			}
+		}
+
+		if ppid <= 1 {
+			break
+		}
+		pid = strconv.Itoa(ppid)
+	}
+	return nil, ErrNoSSHSession
+}
+
+// sshSessionFromConfig returns a session of unknown address that guards
+// every port sshd is configured to listen on.
+func (d *Detector) sshSessionFromConfig() *SSHSession {
+	ports := []int{22}
+	if cfg, err := d.ReadSSHDConfig(); err == nil && len(cfg.ListenPorts()) > 0 {
+		ports = cfg.ListenPorts()
+	}
+	return &SSHSession{Source: "sshd_config", Ports: ports}
+}
+
+func parseAddrPort(addr, port string) (netip.AddrPort, error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	return netip.AddrPortFrom(ip.Unmap(), uint16(p)), nil
+}
+
+// LockoutError is returned when a change would cut off the current SSH session.
+type LockoutError struct {
+	Session *SSHSession
+	Change  string // e.g., "deny 22/tcp"
+}
+
+func (e *LockoutError) Error() string {
+	if !e.Session.Client.IsValid() {
+		return fmt.Sprintf("refusing to %s: it could lock out the SSH session on one of sshd's ports %v",
+			e.Change, e.Session.Ports)
+	}
+	return fmt.Sprintf("refusing to %s: it would lock out the SSH session from %s on port %d",
+		e.Change, e.Session.Client.Addr(), e.Session.Port())
+}
+
+// CheckAddRule returns a *LockoutError if adding rule would block the
+// session. A nil session permits every change.
+func (s *SSHSession) CheckAddRule(rule PortRule) error {
+	if s.affects(rule) && rule.Action == RuleDeny {
+		return &LockoutError{Session: s, Change: rule.String()}
+	}
+	return nil
+}
+
+// CheckRemoveRule returns a *LockoutError if removing rule could block the
+// session. A nil session permits every change.
+func (s *SSHSession) CheckRemoveRule(rule PortRule) error {
+	if s.affects(rule) && rule.Action == RuleAllow {
+		return &LockoutError{Session: s, Change: "remove " + rule.String()}
+	}
+	return nil
+}
+
+// affects reports whether rule applies to a port the session may use.
+func (s *SSHSession) affects(rule PortRule) bool {
+	return s != nil && rule.Protocol == TCP && slices.Contains(s.guardedPorts(), rule.Port)
+}
+
+// CheckSSHPorts returns a *LockoutError if sshd listening only on ports
+// would leave a port the session may use closed to new logins. A nil session
+// permits every change.
+func (s *SSHSession) CheckSSHPorts(ports []int) error {
+	if s == nil {
+		return nil
+	}
+	for _, port := range s.guardedPorts() {
+		if !slices.Contains(ports, port) {
+			return &LockoutError{Session: s, Change: fmt.Sprintf("move sshd off port %d", port)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package osdetect
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const sysctlDir = "/etc/sysctl.d"
+
+// sysctlPreviousLabel prefixes the comment recording a key's value before the drop-in set it.
+const sysctlPreviousLabel = "# previous: "
+
+var sysctlKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.:@/-]*$`)
+
+// sysctlPath returns the /proc/sys path of key. As with sysctl(8), the
+// first separator picks the form: in "net/ipv4/conf/eth0.100/forwarding"
+// the key is already a path, while in dot form '.' and '/' swap, so
+// "net.ipv4.conf.eth0/100.forwarding" names the same file.
+func sysctlPath(key string) (string, error) {
+	if !sysctlKeyPattern.MatchString(key) {
+		return "", fmt.Errorf("invalid sysctl key '%s'", key)
+	}
+	name := key
+	if i := strings.IndexAny(key, "./"); i >= 0 && key[i] == '.' {
+		name = strings.Map(func(r rune) rune {
+			switch r {
+			case '.':
+				return '/'
+			case '/':
+				return '.'
+			}
+			return r
+		}, key)
+	}
+	if strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid sysctl key '%s'", key)
+	}
+	return path.Join("/proc/sys", name), nil
+}
+
+// ReadSysctl returns the host's current value of a kernel parameter.
+func ReadSysctl(key string) (string, error) {
+	return defaultDetector.ReadSysctl(key)
+}
+
+// ReadSysctl returns the current value of key from /proc/sys. Values with
+// several fields, such as net.ipv4.tcp_rmem, are separated by single spaces.
+func (d *Detector) ReadSysctl(key string) (string, error) {
+	name, err := sysctlPath(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := d.readFile(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read sysctl %s: %w", key, err)
+	}
+	return strings.Join(strings.Fields(string(data)), " "), nil
+}
+
+// WriteSysctl sets a kernel parameter on the host until reboot, returning its previous value.
+func WriteSysctl(key, value string) (string, error) {
+	return defaultDetector.WriteSysctl(key, value)
+}
+
+// WriteSysctl writes value to key in /proc/sys and returns the previous
+// value. The change is lost on reboot; use SysctlDropIn to persist it.
+func (d *Detector) WriteSysctl(key, value string) (string, error) {
+	previous, err := d.ReadSysctl(key)
+	if err != nil {
+		return "", err
+	}
+	if previous == strings.Join(strings.Fields(value), " ") {
+		return previous, nil
+	}
+
+	name, _ := sysctlPath(key)
+	if err := d.writeInPlace(name, []byte(value)); err != nil {
+		return "", fmt.Errorf("failed to write sysctl %s: %w", key, err)
+	}
+	return previous, nil
+}
+
+// SysctlDropIn is an application's persistent kernel parameters, stored in
+// /etc/sysctl.d/99-<owner>.conf. Each key's value from before the drop-in
+// first set it is recorded in the file, so Remove can roll it back.
+type SysctlDropIn struct {
+	d     *Detector
+	owner string
+}
+
+// NewSysctlDropIn returns the host's sysctl drop-in for owner.
+func NewSysctlDropIn(owner string) *SysctlDropIn {
+	return defaultDetector.SysctlDropIn(owner)
+}
+
+// SysctlDropIn returns the sysctl drop-in for owner beneath the detector's Root.
+func (d *Detector) SysctlDropIn(owner string) *SysctlDropIn {
+	return &SysctlDropIn{d: d, owner: owner}
+}
+
+// Path returns the drop-in's path.
+func (s *SysctlDropIn) Path() string {
+	return path.Join(sysctlDir, "99-"+s.owner+".conf")
+}
+
+// SysctlSetting is a key set by a SysctlDropIn.
+type SysctlSetting struct {
+	Key      string
+	Value    string
+	Previous string // Value before the drop-in first set Key; empty if unknown
+}
+
+// Settings returns the keys set by the drop-in, in file order.
+func (s *SysctlDropIn) Settings() ([]SysctlSetting, error) {
+	if !ownerPattern.MatchString(s.owner) {
+		return nil, fmt.Errorf("invalid owner '%s'", s.owner)
+	}
+	data, err := s.d.readFile(s.Path())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var settings []SysctlSetting
+	previous := make(map[string]string)
+	for _, line := range parseLines(string(data), nil) {
+		if rest, ok := strings.CutPrefix(line, sysctlPreviousLabel); ok {
+			if key, value, ok := strings.Cut(rest, "="); ok {
+				previous[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+			continue
+		}
+		if line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			settings = append(settings, SysctlSetting{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)})
+		}
+	}
+	for i := range settings {
+		settings[i].Previous = previous[settings[i].Key]
+	}
+	return settings, nil
+}
+
+// Set applies key=value now and persists it in the drop-in. It returns
+// the value key had before this call, for rollback.
+func (s *SysctlDropIn) Set(key, value string) (string, error) {
+	if strings.ContainsAny(value, "\n\x00") {
+		return "", fmt.Errorf("invalid value for sysctl %s", key)
+	}
+	settings, err := s.Settings()
+	if err != nil {
+		return "", err
+	}
+
+	previous, err := s.d.WriteSysctl(key, value)
+	if err != nil {
+		return "", err
+	}
+
+	found := false
+	for i := range settings {
+		if settings[i].Key == key {
+			settings[i].Value, found = value, true
+		}
+	}
+	if !found {
+		settings = append(settings, SysctlSetting{Key: key, Value: value, Previous: previous})
+	}
+	return previous, s.write(settings)
+}
+
+// Unset removes key from the drop-in and restores its recorded previous value.
+func (s *SysctlDropIn) Unset(key string) error {
+	settings, err := s.Settings()
+	if err != nil {
+		return err
+	}
+
+	kept := settings[:0]
+	for _, setting := range settings {
+		if setting.Key != key {
+			kept = append(kept, setting)
+			continue
+		}
+		if setting.Previous != "" {
+			if _, err := s.d.WriteSysctl(key, setting.Previous); err != nil {
+				return err
+			}
+		}
+	}
+	if len(kept) == 0 {
+		_, err := s.d.removeFile(s.Path())
+		return err
+	}
+	return s.write(kept)
+}
+
+// Remove restores every key's recorded previous value and deletes the drop-in.
+func (s *SysctlDropIn) Remove() error {
+	settings, err := s.Settings()
+	if err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		if setting.Previous == "" {
+			continue
+		}
+		// Keys can disappear, e.g., with their interface or module
+		if _, err := s.d.WriteSysctl(setting.Key, setting.Previous); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	_, err = s.d.removeFile(s.Path())
+	return err
+}
+
+// write replaces the drop-in with settings.
+func (s *SysctlDropIn) write(settings []SysctlSetting) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "# Managed by %s; removed on uninstall.\n", s.owner)
+	for _, setting := range settings {
+		if setting.Previous != "" {
+			fmt.Fprintf(&buf, "%s%s = %s\n", sysctlPreviousLabel, setting.Key, setting.Previous)
+		}
+		fmt.Fprintf(&buf, "%s = %s\n", setting.Key, setting.Value)
+	}
+	_, err := s.d.writeFile(s.Path(), []byte(buf.String()), 0644)
+	return err
+}
@@ -0,0 +1,106 @@
+package osdetect
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSysctlPath(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"net.ipv4.ip_forward", "/proc/sys/net/ipv4/ip_forward"},
+		{"net/ipv4/ip_forward", "/proc/sys/net/ipv4/ip_forward"},
+		{"net.ipv4.conf.eth0/100.rp_filter", "/proc/sys/net/ipv4/conf/eth0.100/rp_filter"},
+		{"net/ipv4/conf/eth0.100/rp_filter", "/proc/sys/net/ipv4/conf/eth0.100/rp_filter"},
+		{"kernel.core_pattern", "/proc/sys/kernel/core_pattern"},
+		{"vm", "/proc/sys/vm"},
+	}
+	for _, tt := range tests {
+		if got, err := sysctlPath(tt.key); err != nil || got != tt.want {
+			t.Errorf("sysctlPath(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+		}
+	}
+
+	for _, key := range []string{"", "../etc/passwd", "net/../../etc/shadow", "net.//.etc", "net.ipv4 ip_forward", "/net/ipv4"} {
+		if got, err := sysctlPath(key); err == nil {
+			t.Errorf("sysctlPath(%q) = %q, want error", key, got)
+		}
+	}
+}
+
+func TestSysctlDropIn(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "proc/sys/net/ipv4/ip_forward", "0\n")
+	writeTestFile(t, root, "proc/sys/net/ipv4/conf/eth0.100/rp_filter", "1\n")
+	s := NewRootDetector(root).SysctlDropIn("myapp")
+
+	if settings, err := s.Settings(); err != nil || settings != nil {
+		t.Fatalf("Settings() = %v, %v, want none", settings, err)
+	}
+	if previous, err := s.Set("net.ipv4.ip_forward", "1"); err != nil || previous != "0" {
+		t.Fatalf("Set(ip_forward) = %q, %v, want previous 0", previous, err)
+	}
+	if previous, err := s.Set("net.ipv4.conf.eth0/100.rp_filter", "2"); err != nil || previous != "1" {
+		t.Fatalf("Set(rp_filter) = %q, %v, want previous 1", previous, err)
+	}
+	// Setting a key again keeps the value from before the drop-in
+	if previous, err := s.Set("net.ipv4.ip_forward", "1"); err != nil || previous != "1" {
+		t.Fatalf("Set(ip_forward) again = %q, %v, want previous 1", previous, err)
+	}
+
+	readFile := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got := readFile("proc/sys/net/ipv4/ip_forward"); got != "1" {
+		t.Errorf("ip_forward = %q, want 1", got)
+	}
+	if got := readFile("proc/sys/net/ipv4/conf/eth0.100/rp_filter"); got != "2" {
+		t.Errorf("rp_filter = %q, want 2", got)
+	}
+	want := "# Managed by myapp; removed on uninstall.\n" +
+		"# previous: net.ipv4.ip_forward = 0\n" +
+		"net.ipv4.ip_forward = 1\n" +
+		"# previous: net.ipv4.conf.eth0/100.rp_filter = 1\n" +
+		"net.ipv4.conf.eth0/100.rp_filter = 2\n"
+	if got := readFile("etc/sysctl.d/99-myapp.conf"); got != want {
+		t.Errorf("drop-in =\n%s\nwant\n%s", got, want)
+	}
+
+	settings, err := s.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSettings := []SysctlSetting{
+		{Key: "net.ipv4.ip_forward", Value: "1", Previous: "0"},
+		{Key: "net.ipv4.conf.eth0/100.rp_filter", Value: "2", Previous: "1"},
+	}
+	if !reflect.DeepEqual(settings, wantSettings) {
+		t.Errorf("Settings() = %+v, want %+v", settings, wantSettings)
+	}
+
+	// Unset restores the previous value and removes the file with the last key
+	if err := s.Unset("net.ipv4.ip_forward"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile("proc/sys/net/ipv4/ip_forward"); got != "0" {
+		t.Errorf("ip_forward after Unset = %q, want 0", got)
+	}
+	if err := s.Unset("net.ipv4.conf.eth0/100.rp_filter"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile("proc/sys/net/ipv4/conf/eth0.100/rp_filter"); got != "1" {
+		t.Errorf("rp_filter after Unset = %q, want 1", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "etc/sysctl.d/99-myapp.conf")); !os.IsNotExist(err) {
+		t.Errorf("drop-in still exists after the last Unset: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package osdetect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// systemdUnitDir is where administrator unit files are installed.
+const systemdUnitDir = "/etc/systemd/system"
+
+// ErrUnitNotFound is returned when querying a unit systemd does not know about.
+var ErrUnitNotFound = errors.New("unit not found")
+
+// Systemd manages systemd units through systemctl.
+type Systemd struct {
+	d *Detector
+}
+
+// NewSystemd returns a Systemd that manages units on the host.
+func NewSystemd() *Systemd {
+	return defaultDetector.Systemd()
+}
+
+// Systemd returns a Systemd that runs systemctl with the detector's Runner
+// and writes unit files beneath its Root.
+func (d *Detector) Systemd() *Systemd {
+	return &Systemd{d: d}
+}
+
+// SystemdError is returned when a systemctl operation fails.
+type SystemdError struct {
+	Op   string // systemctl verb, e.g., "start", "enable"
+	Unit string
+	Err  error // Usually *ExitError with systemctl's output
+}
+
+func (e *SystemdError) Error() string {
+	if e.Unit == "" {
+		return fmt.Sprintf("systemctl %s failed: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("failed to %s %s: %v", e.Op, e.Unit, e.Err)
+}
+
+func (e *SystemdError) Unwrap() error {
+	return e.Err
+}
+
+// UnitStatus is the runtime state of a unit as reported by `systemctl show`.
+type UnitStatus struct {
+	Unit          string
+	LoadState     string // e.g., "loaded", "not-found"
+	ActiveState   string // e.g., "active", "inactive", "failed"
+	SubState      string // e.g., "running", "dead", "exited"
+	UnitFileState string // e.g., "enabled", "disabled", "static"
+	MainPID       int    // 0 if the unit has no running main process
+}
+
+// IsActive reports whether the unit is active.
+func (u *UnitStatus) IsActive() bool {
+	return u.ActiveState == "active"
+}
+
+// IsEnabled reports whether the unit is enabled to start at boot.
+func (u *UnitStatus) IsEnabled() bool {
+	return u.UnitFileState == "enabled"
+}
+
+// UnitName normalizes name to a full unit name, appending ".service" if
+// it has no unit type suffix.
+func UnitName(name string) string {
+	switch path.Ext(name) {
+	case ".service", ".socket", ".timer", ".target", ".path", ".mount",
+		".automount", ".swap", ".slice", ".scope", ".device":
+		return name
+	}
+	return name + ".service"
+}
+
+// validateUnit checks that unit is safe to use as a file name.
+func validateUnit(unit string) error {
+	if unit == "" || strings.ContainsAny(unit, "/\x00") || strings.HasPrefix(unit, ".") {
+		return fmt.Errorf("invalid unit name '%s'", unit)
+	}
+	return nil
+}
+
+// UnitPath returns the path a unit file is installed at.
+func (s *Systemd) UnitPath(unit string) string {
+	return path.Join(systemdUnitDir, UnitName(unit))
+}
+
+// WriteUnit installs a unit file, reporting whether its content changed.
+// Call DaemonReload after changing units.
+func (s *Systemd) WriteUnit(unit string, content []byte) (bool, error) {
+	unit = UnitName(unit)
+	if err := validateUnit(unit); err != nil {
+		return false, err
+	}
+	return s.d.writeFile(s.UnitPath(unit), content, 0644)
+}
+
+// RemoveUnit deletes a unit file installed by WriteUnit, reporting whether it existed.
+// Stop and disable the unit first, and call DaemonReload afterwards.
+func (s *Systemd) RemoveUnit(unit string) (bool, error) {
+	unit = UnitName(unit)
+	if err := validateUnit(unit); err != nil {
+		return false, err
+	}
+	return s.d.removeFile(s.UnitPath(unit))
+}
+
+// DaemonReload reloads systemd's unit configuration.
+func (s *Systemd) DaemonReload(ctx context.Context) error {
+	return s.systemctl(ctx, "daemon-reload", "")
+}
+
+// Enable enables unit to start at boot.
+func (s *Systemd) Enable(ctx context.Context, unit string) error {
+	return s.systemctl(ctx, "enable", unit)
+}
+
+// Disable disables unit from starting at boot.
+func (s *Systemd) Disable(ctx context.Context, unit string) error {
+	return s.systemctl(ctx, "disable", unit)
+}
+
+// Start starts unit.
+func (s *Systemd) Start(ctx context.Context, unit string) error {
+	return s.systemctl(ctx, "start", unit)
+}
+
+// Stop stops unit.
+func (s *Systemd) Stop(ctx context.Context, unit string) error {
+	return s.systemctl(ctx, "stop", unit)
+}
+
+// Restart restarts unit, starting it if it is not running.
+func (s *Systemd) Restart(ctx context.Context, unit string) error {
+	return s.systemctl(ctx, "restart", unit)
+}
+
+// Status queries the state of unit. It returns ErrUnitNotFound if systemd
+// has no unit with that name.
+func (s *Systemd) Status(ctx context.Context, unit string) (*UnitStatus, error) {
+	unit = UnitName(unit)
+	if err := validateUnit(unit); err != nil {
+		return nil, err
+	}
+
+	res, err := s.d.runner().Run(ctx, Query("systemctl", "show", unit, "--no-pager",
+		"--property=LoadState,ActiveState,SubState,UnitFileState,MainPID"))
+	if err != nil {
+		return nil, &SystemdError{Op: "show", Unit: unit, Err: err}
+	}
+
+	props := parseProperties(string(res.Stdout))
+	status := &UnitStatus{
+		Unit:          unit,
+		LoadState:     props["LoadState"],
+		ActiveState:   props["ActiveState"],
+		SubState:      props["SubState"],
+		UnitFileState: props["UnitFileState"],
+	}
+	status.MainPID, _ = strconv.Atoi(props["MainPID"])
+
+	if status.LoadState == "not-found" {
+		return status, &SystemdError{Op: "show", Unit: unit, Err: ErrUnitNotFound}
+	}
+	return status, nil
+}
+
+// systemctl runs a systemctl verb on unit, or with no unit if unit is empty.
+func (s *Systemd) systemctl(ctx context.Context, op, unit string) error {
+	args := []string{op}
+	if unit != "" {
+		unit = UnitName(unit)
+		if err := validateUnit(unit); err != nil {
+			return err
+		}
+		args = append(args, unit)
+	}
+
+	if _, err := s.d.runner().Run(ctx, Command("systemctl", args...)); err != nil {
+		return &SystemdError{Op: op, Unit: unit, Err: err}
+	}
+	return nil
+}
+
+// parseProperties parses "Key=Value" lines.
+func parseProperties(out string) map[string]string {
+	props := make(map[string]string)
+	for _, line := range parseLines(out, nil) {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			props[key] = value
+		}
+	}
+	return props
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package osdetect
+
+import "errors"
+
+// uname is not available without a Unix kernel.
+func uname() (machine, release string, err error) {
+	return "", "", errors.ErrUnsupported
+}
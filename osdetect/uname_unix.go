@@ -0,0 +1,14 @@
+//go:build unix
+
+package osdetect
+
+import "golang.org/x/sys/unix"
+
+// uname returns the machine and release fields of the running kernel.
+func uname() (machine, release string, err error) {
+	var u unix.Utsname
+	if err := unix.Uname(&u); err != nil {
+		return "", "", err
+	}
+	return unix.ByteSliceToString(u.Machine[:]), unix.ByteSliceToString(u.Release[:]), nil
+}
@@ -0,0 +1,371 @@
+package osdetect
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUserNotFound  = errors.New("user not found")
+	ErrGroupNotFound = errors.New("group not found")
+)
+
+// Name rules shared by useradd and busybox adduser.
+var accountNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+
+// nologinShells are checked in order for a shell that refuses logins.
+var nologinShells = []string{"/usr/sbin/nologin", "/sbin/nologin", "/usr/bin/nologin", "/bin/false"}
+
+// User is an entry in /etc/passwd.
+type User struct {
+	Name    string
+	UID     int    // -1 if not yet assigned, e.g., under DryRunRunner
+	GID     int    // -1 if not yet assigned
+	Comment string // GECOS field
+	Home    string
+	Shell   string
+}
+
+// IsSystem reports whether u is a system account, below the usual first
+// regular UID of 1000, and not root.
+func (u *User) IsSystem() bool {
+	return u.UID > 0 && u.UID < 1000
+}
+
+// Group is an entry in /etc/group.
+type Group struct {
+	Name    string
+	GID     int      // -1 if not yet assigned, e.g., under DryRunRunner
+	Members []string // Supplementary members; users with GID as primary group are not listed
+}
+
+// SystemUser describes a daemon account created by EnsureSystemUser.
+type SystemUser struct {
+	Name    string   // e.g., "myapp"
+	Group   string   // Primary group, created if missing; defaults to Name
+	Groups  []string // Supplementary groups, which must exist
+	Home    string   // Created if missing; defaults to /var/lib/<Name>
+	Shell   string   // Defaults to the system's nologin
+	Comment string
+}
+
+// LookupUser looks up a user on the host by name.
+func LookupUser(name string) (*User, error) {
+	return defaultDetector.LookupUser(name)
+}
+
+// LookupUser returns the /etc/passwd entry for name. Users from other
+// sources, such as LDAP, are not found.
+func (d *Detector) LookupUser(name string) (*User, error) {
+	var user *User
+	err := d.scanAccounts("/etc/passwd", func(fields []string) bool {
+		if len(fields) < 7 || fields[0] != name {
+			return false
+		}
+		user = &User{Name: fields[0], Comment: fields[4], Home: fields[5], Shell: fields[6]}
+		user.UID, _ = strconv.Atoi(fields[2])
+		user.GID, _ = strconv.Atoi(fields[3])
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, name)
+	}
+	return user, nil
+}
+
+// LookupGroup looks up a group on the host by name.
+func LookupGroup(name string) (*Group, error) {
+	return defaultDetector.LookupGroup(name)
+}
+
+// LookupGroup returns the /etc/group entry for name.
+func (d *Detector) LookupGroup(name string) (*Group, error) {
+	var group *Group
+	err := d.scanAccounts("/etc/group", func(fields []string) bool {
+		if len(fields) < 4 || fields[0] != name {
+			return false
+		}
+		group = &Group{Name: fields[0]}
+		group.GID, _ = strconv.Atoi(fields[2])
+		if fields[3] != "" {
+			group.Members = strings.Split(fields[3], ",")
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+	return group, nil
+}
+
+// scanAccounts calls fn with the colon-separated fields of each entry in
+// name until fn returns true.
+func (d *Detector) scanAccounts(name string, fn func(fields []string) bool) error {
+	file, err := d.open(name)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if fn(strings.Split(line, ":")) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// NologinShell returns the host's shell for accounts that must not log in.
+func NologinShell() string {
+	return defaultDetector.NologinShell()
+}
+
+// NologinShell returns the first of /usr/sbin/nologin, /sbin/nologin,
+// /usr/bin/nologin and /bin/false that exists.
+func (d *Detector) NologinShell() string {
+	for _, shell := range nologinShells {
+		if d.exists(shell) {
+			return shell
+		}
+	}
+	return "/bin/false"
+}
+
+// EnsureSystemGroup creates a system group on the host if it does not exist.
+func EnsureSystemGroup(ctx context.Context, name string) (*Group, error) {
+	return defaultDetector.EnsureSystemGroup(ctx, name)
+}
+
+// EnsureSystemGroup creates system group name with groupadd, or busybox
+// addgroup on Alpine, unless it already exists.
+func (d *Detector) EnsureSystemGroup(ctx context.Context, name string) (*Group, error) {
+	if !accountNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid group name '%s'", name)
+	}
+	if group, err := d.LookupGroup(name); !errors.Is(err, ErrGroupNotFound) {
+		return group, err
+	}
+
+	cmd := Command("groupadd", "--system", name)
+	if !d.hasCommand("groupadd") {
+		cmd = Command("addgroup", "-S", name)
+	}
+	if _, err := d.runner().Run(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("failed to create group %s: %w", name, err)
+	}
+	if d.dryRunner() != nil {
+		// Nothing was created, so describe the group that would be
+		return &Group{Name: name, GID: -1}, nil
+	}
+	return d.LookupGroup(name)
+}
+
+// EnsureSystemUser creates a system user on the host if it does not exist.
+func EnsureSystemUser(ctx context.Context, spec SystemUser) (*User, error) {
+	return defaultDetector.EnsureSystemUser(ctx, spec)
+}
+
+// EnsureSystemUser creates the system user and primary group described by
+// spec with useradd, or busybox adduser on Alpine. An existing user is not
+// modified, except that it is added to any missing supplementary groups.
+func (d *Detector) EnsureSystemUser(ctx context.Context, spec SystemUser) (*User, error) {
+	if !accountNamePattern.MatchString(spec.Name) {
+		return nil, fmt.Errorf("invalid user name '%s'", spec.Name)
+	}
+	if spec.Group == "" {
+		spec.Group = spec.Name
+	}
+	if spec.Home == "" {
+		spec.Home = path.Join("/var/lib", spec.Name)
+	}
+	if spec.Shell == "" {
+		spec.Shell = d.NologinShell()
+	}
+	if strings.Contains(spec.Comment, ":") {
+		return nil, fmt.Errorf("invalid comment for user %s", spec.Name)
+	}
+
+	user, err := d.LookupUser(spec.Name)
+	if errors.Is(err, ErrUserNotFound) {
+		user, err = d.createSystemUser(ctx, spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range spec.Groups {
+		if err := d.addToGroup(ctx, user.Name, group); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// createSystemUser creates spec's primary group and then the user.
+func (d *Detector) createSystemUser(ctx context.Context, spec SystemUser) (*User, error) {
+	if _, err := d.EnsureSystemGroup(ctx, spec.Group); err != nil {
+		return nil, err
+	}
+
+	var cmd Cmd
+	if d.hasCommand("useradd") {
+		args := []string{"--system", "--gid", spec.Group, "--home-dir", spec.Home, "--create-home", "--shell", spec.Shell}
+		if spec.Comment != "" {
+			args = append(args, "--comment", spec.Comment)
+		}
+		cmd = Command("useradd", append(args, spec.Name)...)
+	} else {
+		// busybox: -S system, -D no password
+		args := []string{"-S", "-D", "-G", spec.Group, "-h", spec.Home, "-s", spec.Shell}
+		if spec.Comment != "" {
+			args = append(args, "-g", spec.Comment)
+		}
+		cmd = Command("adduser", append(args, spec.Name)...)
+	}
+	if _, err := d.runner().Run(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("failed to create user %s: %w", spec.Name, err)
+	}
+	if d.dryRunner() != nil {
+		return &User{Name: spec.Name, UID: -1, GID: -1, Comment: spec.Comment, Home: spec.Home, Shell: spec.Shell}, nil
+	}
+	return d.LookupUser(spec.Name)
+}
+
+// addToGroup adds user to the supplementary group unless it is already a member.
+func (d *Detector) addToGroup(ctx context.Context, user, group string) error {
+	g, err := d.LookupGroup(group)
+	if err != nil {
+		return err
+	}
+	for _, member := range g.Members {
+		if member == user {
+			return nil
+		}
+	}
+
+	cmd := Command("usermod", "--append", "--groups", group, user)
+	if !d.hasCommand("usermod") {
+		cmd = Command("addgroup", user, group)
+	}
+	if _, err := d.runner().Run(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to add user %s to group %s: %w", user, group, err)
+	}
+	return nil
+}
+
+// RemoveSystemUser removes a system user from the host.
+func RemoveSystemUser(ctx context.Context, name string) error {
+	return defaultDetector.RemoveSystemUser(ctx, name)
+}
+
+// RemoveSystemUser removes system user name with userdel, or busybox
+// deluser, and then its primary group if no other user has it. The home
+// directory is kept. Removing a user that does not exist is a no-op, and
+// root or regular users are refused.
+func (d *Detector) RemoveSystemUser(ctx context.Context, name string) error {
+	user, err := d.LookupUser(name)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.IsSystem() {
+		return fmt.Errorf("refusing to remove user %s: UID %d is not a system account", name, user.UID)
+	}
+
+	cmd := Command("userdel", name)
+	if !d.hasCommand("userdel") {
+		cmd = Command("deluser", name)
+	}
+	if _, err := d.runner().Run(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to remove user %s: %w", name, err)
+	}
+
+	// userdel removes the user's group only when USERGROUPS_ENAB is set;
+	// deluser never does. A dry run leaves the user in /etc/passwd, so it is
+	// not counted as a member of its own group.
+	group, err := d.primaryGroup(user.GID)
+	if err != nil || group != name {
+		return nil
+	}
+	return d.removeSystemGroup(ctx, group, name)
+}
+
+// primaryGroup returns the name of the group with gid.
+func (d *Detector) primaryGroup(gid int) (string, error) {
+	var name string
+	err := d.scanAccounts("/etc/group", func(fields []string) bool {
+		if len(fields) >= 3 && fields[2] == strconv.Itoa(gid) {
+			name = fields[0]
+			return true
+		}
+		return false
+	})
+	if name == "" && err == nil {
+		err = fmt.Errorf("%w: GID %d", ErrGroupNotFound, gid)
+	}
+	return name, err
+}
+
+// RemoveSystemGroup removes a system group from the host.
+func RemoveSystemGroup(ctx context.Context, name string) error {
+	return defaultDetector.RemoveSystemGroup(ctx, name)
+}
+
+// RemoveSystemGroup removes group name with groupdel, or busybox delgroup.
+// Removing a group that does not exist is a no-op. A group that is still
+// some user's primary group is kept.
+func (d *Detector) RemoveSystemGroup(ctx context.Context, name string) error {
+	return d.removeSystemGroup(ctx, name, "")
+}
+
+// removeSystemGroup removes group name unless it is the primary group of a
+// user other than removed.
+func (d *Detector) removeSystemGroup(ctx context.Context, name, removed string) error {
+	group, err := d.LookupGroup(name)
+	if errors.Is(err, ErrGroupNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if group.GID == 0 || group.GID >= 1000 {
+		return fmt.Errorf("refusing to remove group %s: GID %d is not a system group", name, group.GID)
+	}
+
+	inUse := false
+	err = d.scanAccounts("/etc/passwd", func(fields []string) bool {
+		inUse = len(fields) >= 4 && fields[0] != removed && fields[3] == strconv.Itoa(group.GID)
+		return inUse
+	})
+	if err != nil || inUse {
+		return err
+	}
+
+	cmd := Command("groupdel", name)
+	if !d.hasCommand("groupdel") {
+		cmd = Command("delgroup", name)
+	}
+	if _, err := d.runner().Run(ctx, cmd); err != nil {
+		return fmt.Errorf("failed to remove group %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package osdetect
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const (
+	testPasswd = "root:x:0:0:root:/root:/bin/bash\n" +
+		"daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin\n" +
+		"alice:x:1000:1000:Alice,,,:/home/alice:/bin/bash\n"
+	testGroup = "root:x:0:\n" +
+		"daemon:x:1:\n" +
+		"adm:x:4:syslog,alice\n" +
+		"alice:x:1000:\n"
+)
+
+// accountsRunner applies account commands to the passwd and group files
+// in files, so lookups after a command see its effect.
+func accountsRunner(files fstest.MapFS, paths map[string]string) *RecordingRunner {
+	appendLine := func(name, line string) {
+		files[name] = &fstest.MapFile{Data: append(files[name].Data, line...)}
+	}
+	removeLine := func(name, entry string) {
+		var kept []string
+		for _, line := range strings.SplitAfter(string(files[name].Data), "\n") {
+			if !strings.HasPrefix(line, entry+":") {
+				kept = append(kept, line)
+			}
+		}
+		files[name] = &fstest.MapFile{Data: []byte(strings.Join(kept, ""))}
+	}
+
+	return &RecordingRunner{Paths: paths, Handler: func(cmd Cmd) (*Result, error) {
+		name := cmd.Args[len(cmd.Args)-1]
+		switch cmd.Name {
+		case "groupadd", "addgroup":
+			if cmd.Name == "addgroup" && cmd.Args[0] != "-S" {
+				return nil, nil // busybox addgroup user group
+			}
+			appendLine("etc/group", name+":x:998:\n")
+		case "useradd", "adduser":
+			appendLine("etc/passwd", name+":x:998:998::/var/lib/"+name+":/usr/sbin/nologin\n")
+		case "userdel", "deluser":
+			removeLine("etc/passwd", name)
+		case "groupdel", "delgroup":
+			removeLine("etc/group", name)
+		}
+		return nil, nil
+	}}
+}
+
+func TestLookupAccounts(t *testing.T) {
+	d := NewDetector(fstest.MapFS{
+		"etc/passwd": {Data: []byte(testPasswd)},
+		"etc/group":  {Data: []byte(testGroup)},
+	})
+
+	user, err := d.LookupUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &User{Name: "alice", UID: 1000, GID: 1000, Comment: "Alice,,,", Home: "/home/alice", Shell: "/bin/bash"}
+	if !reflect.DeepEqual(user, want) {
+		t.Errorf("LookupUser() = %+v, want %+v", user, want)
+	}
+	if user.IsSystem() {
+		t.Error("alice reported as a system user")
+	}
+
+	group, err := d.LookupGroup("adm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.GID != 4 || !reflect.DeepEqual(group.Members, []string{"syslog", "alice"}) {
+		t.Errorf("LookupGroup() = %+v, want GID 4 with syslog and alice", group)
+	}
+
+	if _, err := d.LookupUser("nobody"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("LookupUser(nobody) error = %v, want ErrUserNotFound", err)
+	}
+	if _, err := d.LookupGroup("nogroup"); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("LookupGroup(nogroup) error = %v, want ErrGroupNotFound", err)
+	}
+}
+
+func TestEnsureSystemUserCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths map[string]string
+		want  []string
+	}{
+		{
+			name: "shadow-utils",
+			paths: map[string]string{
+				"groupadd": "/usr/sbin/groupadd",
+				"useradd":  "/usr/sbin/useradd",
+				"usermod":  "/usr/sbin/usermod",
+			},
+			want: []string{
+				"groupadd --system myapp",
+				"useradd --system --gid myapp --home-dir /var/lib/myapp --create-home --shell /usr/sbin/nologin --comment 'My App' myapp",
+				"usermod --append --groups adm myapp",
+			},
+		},
+		{
+			name: "busybox",
+			want: []string{
+				"addgroup -S myapp",
+				"adduser -S -D -G myapp -h /var/lib/myapp -s /usr/sbin/nologin -g 'My App' myapp",
+				"addgroup myapp adm",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := fstest.MapFS{
+				"etc/passwd":       {Data: []byte(testPasswd)},
+				"etc/group":        {Data: []byte(testGroup)},
+				"usr/sbin/nologin": {Data: []byte{}},
+			}
+			r := accountsRunner(files, tt.paths)
+			d := NewDetector(files)
+			d.Runner = r
+
+			spec := SystemUser{Name: "myapp", Groups: []string{"adm"}, Comment: "My App"}
+			user, err := d.EnsureSystemUser(context.Background(), spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.UID != 998 || user.Home != "/var/lib/myapp" {
+				t.Errorf("EnsureSystemUser() = %+v, want UID 998 in /var/lib/myapp", user)
+			}
+			if got := r.CommandLines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commands =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureSystemUserExisting(t *testing.T) {
+	r := &RecordingRunner{}
+	d := NewDetector(fstest.MapFS{
+		"etc/passwd": {Data: []byte(testPasswd)},
+		"etc/group":  {Data: []byte(testGroup)},
+	})
+	d.Runner = r
+
+	user, err := d.EnsureSystemUser(context.Background(), SystemUser{Name: "alice", Groups: []string{"adm"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.UID != 1000 {
+		t.Errorf("UID = %d, want the existing 1000", user.UID)
+	}
+	if got := r.CommandLines(); len(got) != 0 {
+		t.Errorf("commands = %q, want none for an existing member", got)
+	}
+
+	if _, err := d.EnsureSystemUser(context.Background(), SystemUser{Name: "Bad Name"}); err == nil {
+		t.Error("EnsureSystemUser accepted an invalid name")
+	}
+}
+
+func TestEnsureSystemUserDryRun(t *testing.T) {
+	d := NewDetector(fstest.MapFS{
+		"etc/passwd":   {Data: []byte(testPasswd)},
+		"etc/group":    {Data: []byte(testGroup)},
+		"sbin/nologin": {Data: []byte{}},
+	})
+	r := &RecordingRunner{Dry: true, Paths: map[string]string{"useradd": "/usr/sbin/useradd", "groupadd": "/usr/sbin/groupadd"}}
+	d.Runner = r
+
+	user, err := d.EnsureSystemUser(context.Background(), SystemUser{Name: "myapp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &User{Name: "myapp", UID: -1, GID: -1, Home: "/var/lib/myapp", Shell: "/sbin/nologin"}
+	if !reflect.DeepEqual(user, want) {
+		t.Errorf("EnsureSystemUser() = %+v, want %+v", user, want)
+	}
+	wantCmds := []string{
+		"groupadd --system myapp",
+		"useradd --system --gid myapp --home-dir /var/lib/myapp --create-home --shell /sbin/nologin myapp",
+	}
+	if got := r.CommandLines(); !reflect.DeepEqual(got, wantCmds) {
+		t.Errorf("commands =\n%q\nwant\n%q", got, wantCmds)
+	}
+}
+
+func TestRemoveSystemUser(t *testing.T) {
+	files := fstest.MapFS{
+		"etc/passwd": {Data: []byte(testPasswd + "myapp:x:998:998::/var/lib/myapp:/usr/sbin/nologin\n")},
+		"etc/group":  {Data: []byte(testGroup + "myapp:x:998:\n")},
+	}
+	r := accountsRunner(files, map[string]string{"userdel": "/usr/sbin/userdel", "groupdel": "/usr/sbin/groupdel"})
+	d := NewDetector(files)
+	d.Runner = r
+
+	if err := d.RemoveSystemUser(context.Background(), "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"userdel myapp", "groupdel myapp"}; !reflect.DeepEqual(r.CommandLines(), want) {
+		t.Errorf("commands = %q, want %q", r.CommandLines(), want)
+	}
+
+	// Missing users are a no-op, and regular users are refused
+	r.Reset()
+	if err := d.RemoveSystemUser(context.Background(), "myapp"); err != nil {
+		t.Errorf("RemoveSystemUser(missing) = %v, want nil", err)
+	}
+	if err := d.RemoveSystemUser(context.Background(), "alice"); err == nil {
+		t.Error("RemoveSystemUser removed a regular user")
+	}
+	if err := d.RemoveSystemGroup(context.Background(), "root"); err == nil {
+		t.Error("RemoveSystemGroup removed root")
+	}
+	if got := r.CommandLines(); len(got) != 0 {
+		t.Errorf("commands = %q, want none", got)
+	}
+}
+
+func TestRemoveSystemUserDryRun(t *testing.T) {
+	files := fstest.MapFS{
+		"etc/passwd": {Data: []byte(testPasswd + "myapp:x:998:998::/var/lib/myapp:/usr/sbin/nologin\n")},
+		"etc/group":  {Data: []byte(testGroup + "myapp:x:998:\n")},
+	}
+	// Nothing is removed, so the group still looks like myapp's primary group
+	r := &RecordingRunner{Dry: true, Paths: map[string]string{"userdel": "/usr/sbin/userdel", "groupdel": "/usr/sbin/groupdel"}}
+	d := NewDetector(files)
+	d.Runner = r
+
+	if err := d.RemoveSystemUser(context.Background(), "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"userdel myapp", "groupdel myapp"}; !reflect.DeepEqual(r.CommandLines(), want) {
+		t.Errorf("commands = %q, want %q", r.CommandLines(), want)
+	}
+}
@@ -0,0 +1,156 @@
+package osdetect
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed package version of the form [epoch:]version[-release],
+// as used by dpkg, rpm, pacman and apk.
+type Version struct {
+	Epoch   int
+	Version string // Upstream version, e.g., "1.18.0"
+	Release string // Distribution revision, e.g., "2ubuntu1", "1.fc39", "r0"
+}
+
+// ParseVersion parses a package version string.
+func ParseVersion(s string) (Version, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Version{}, fmt.Errorf("empty version")
+	}
+
+	var v Version
+	if epoch, rest, ok := strings.Cut(s, ":"); ok {
+		n, err := strconv.Atoi(epoch)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid epoch in version '%s'", s)
+		}
+		v.Epoch = n
+		s = rest
+	}
+
+	// The release follows the last hyphen; the upstream version may contain hyphens
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		v.Version, v.Release = s[:i], s[i+1:]
+	} else {
+		v.Version = s
+	}
+
+	if v.Version == "" {
+		return Version{}, fmt.Errorf("missing upstream version in '%s'", s)
+	}
+	return v, nil
+}
+
+// String returns the version in [epoch:]version[-release] form.
+func (v Version) String() string {
+	s := v.Version
+	if v.Epoch > 0 {
+		s = strconv.Itoa(v.Epoch) + ":" + s
+	}
+	if v.Release != "" {
+		s += "-" + v.Release
+	}
+	return s
+}
+
+// Compare returns -1, 0 or +1 depending on whether v sorts before, equal
+// to, or after other. A missing release sorts as "", before any release.
+func (v Version) Compare(other Version) int {
+	if v.Epoch != other.Epoch {
+		if v.Epoch < other.Epoch {
+			return -1
+		}
+		return 1
+	}
+	if c := compareSegment(v.Version, other.Version); c != 0 {
+		return c
+	}
+	return compareSegment(v.Release, other.Release)
+}
+
+// CompareVersions parses and compares two version strings.
+// Unparsable versions sort before valid ones.
+func CompareVersions(a, b string) int {
+	va, errA := ParseVersion(a)
+	vb, errB := ParseVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	return va.Compare(vb)
+}
+
+// compareSegment compares version segments using the dpkg algorithm:
+// alternating runs of non-digits (compared by character, with '~' sorting
+// before everything, even the end of the string) and digits (compared numerically).
+func compareSegment(a, b string) int {
+	for a != "" || b != "" {
+		// Compare the non-digit prefix
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			ca, cb := charOrder(a), charOrder(b)
+			if ca != cb {
+				if ca < cb {
+					return -1
+				}
+				return 1
+			}
+			a, b = a[1:], b[1:]
+		}
+
+		// Compare the numeric run
+		var na, nb string
+		na, a = splitDigits(a)
+		nb, b = splitDigits(b)
+		na, nb = strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+		if len(na) != len(nb) {
+			if len(na) < len(nb) {
+				return -1
+			}
+			return 1
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// charOrder returns the sort weight of the first character of s within a
+// non-digit run. Only called when at least one side has a non-digit.
+func charOrder(s string) int {
+	switch {
+	case s == "" || isDigit(s[0]):
+		return 0
+	case s[0] == '~':
+		return -1
+	case isLetter(s[0]):
+		return int(s[0])
+	}
+	return int(s[0]) + 256
+}
+
+func splitDigits(s string) (digits, rest string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,82 @@
+package osdetect
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Version
+	}{
+		{"1.18.0", Version{Version: "1.18.0"}},
+		{"1.18.0-2ubuntu1", Version{Version: "1.18.0", Release: "2ubuntu1"}},
+		{"1:9.18.24-1", Version{Epoch: 1, Version: "9.18.24", Release: "1"}},
+		{"2.4.1-1.fc39", Version{Version: "2.4.1", Release: "1.fc39"}},
+		{"1.2.3-r0", Version{Version: "1.2.3", Release: "r0"}},
+		{"1.0-rc1-3", Version{Version: "1.0-rc1", Release: "3"}},
+		{" 1.0 ", Version{Version: "1.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseVersion(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseVersion(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	for _, input := range []string{"", "x:1.0", "-1:1.0", "-1"} {
+		if v, err := ParseVersion(input); err == nil {
+			t.Errorf("ParseVersion(%q) = %+v, want error", input, v)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.01", "1.1", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0", "1.0a", -1},
+		{"1.0a", "1.0+", -1},
+		{"1:1.0", "2.0", 1},
+		{"1.2-1", "1.2-2", -1},
+		{"1.2-10", "1.2-9", 1},
+		{"1.2", "1.2-1", -1},
+		{"1.18.0-2ubuntu1", "1.18.0-2ubuntu1.1", -1},
+		{"invalid:", "1.0", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			if got := CompareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			// An ordering must be antisymmetric
+			if got := CompareVersions(tt.b, tt.a); got != -tt.want {
+				t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	for _, s := range []string{"1.0", "1:1.0-2", "1.0-rc1-3"} {
+		v, err := ParseVersion(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.String(); got != s {
+			t.Errorf("String() = %q, want %q", got, s)
+		}
+	}
+}